@@ -1,3 +1,3 @@
 module github.com/vtudorache/go-properties
 
-go 1.17
+go 1.23
@@ -0,0 +1,167 @@
+package properties
+
+import (
+	"bytes"
+	"io"
+)
+
+// docLine is a line of the document recorded by LoadWith with the Document
+// option set. The raw text is the line as read, without its final line
+// terminator. For an entry line, key is the key defined by the line, and
+// value, comment and commented are the value and the inline comment loaded
+// from it, so that the line can be written back unchanged while they are.
+// An entry line is superseded by a later definition of the same key.
+type docLine struct {
+	raw        string
+	key        string
+	value      string
+	comment    string
+	commented  bool
+	entry      bool
+	superseded bool
+}
+
+// docEntries returns the index in the document of the last entry line of
+// each key.
+func (p *Table) docEntries() map[string]int {
+	entries := make(map[string]int)
+	for i, d := range p.doc {
+		if d.entry && !d.superseded {
+			entries[d.key] = i
+		}
+	}
+	return entries
+}
+
+// addDocLine appends d to the document. If d is the entry line of a key
+// already defined by the document, the earlier definition is superseded: it's
+// written back as it was read while the key is present, and dropped with the
+// other definitions when the key is deleted.
+func (p *Table) addDocLine(d docLine, entries map[string]int) {
+	if d.entry {
+		if i, found := entries[d.key]; found {
+			p.doc[i].superseded = true
+		}
+		entries[d.key] = len(p.doc)
+	}
+	p.doc = append(p.doc, d)
+}
+
+// trimEOL returns b without its final line terminator, if any.
+func trimEOL(b []byte) []byte {
+	if bytes.HasSuffix(b, []byte("\r\n")) {
+		return b[:len(b)-2]
+	}
+	if n := len(b); n > 0 && (b[n-1] == '\n' || b[n-1] == '\r') {
+		return b[:n-1]
+	}
+	return b
+}
+
+// rawLine returns the raw text of a recorded line, with the line terminators
+// escaped inside an entry spreading across several partial lines replaced by
+// eol.
+func rawLine(raw string, eol []byte) []byte {
+	var b bytes.Buffer
+	for i := 0; i < len(raw); i++ {
+		switch raw[i] {
+		case '\r':
+			if i+1 < len(raw) && raw[i+1] == '\n' {
+				i += 1
+			}
+			b.Write(eol)
+		case '\n':
+			b.Write(eol)
+		default:
+			b.WriteByte(raw[i])
+		}
+	}
+	return b.Bytes()
+}
+
+// storeDocument writes the document recorded by LoadWith to w, followed by
+// the keys of the primary table that the document doesn't define. The
+// comments, the blank lines and the entries whose value and inline comment
+// are unchanged are written as they were read, with the line terminators
+// replaced by the line separator; the other entries are written as done by
+// store, and all the entries of the deleted keys are dropped.
+func (p *Table) storeDocument(w io.Writer, opts StoreOptions) (int, error) {
+	count := 0
+	eol := []byte("\n")
+	if opts.LineSeparator != "" {
+		eol = []byte(opts.LineSeparator)
+	}
+	delim := opts.Delimiter
+	if delim == "" {
+		delim = "="
+	}
+	written := make(map[string]bool)
+	write := func(b []byte) error {
+		if _, e := w.Write(b); e != nil {
+			return e
+		}
+		_, e := w.Write(eol)
+		return e
+	}
+	for _, d := range p.doc {
+		if !d.entry {
+			if e := write(rawLine(d.raw, eol)); e != nil {
+				return count, e
+			}
+			continue
+		}
+		value, found := p.data[d.key]
+		if !found {
+			continue
+		}
+		if d.superseded {
+			if e := write(rawLine(d.raw, eol)); e != nil {
+				return count, e
+			}
+			continue
+		}
+		if e := p.writeKeyComment(w, d.key, opts.Escape, eol); e != nil {
+			return count, e
+		}
+		comment, commented := p.inline[d.key]
+		b := rawLine(d.raw, eol)
+		if value != d.value || comment != d.comment || commented != d.commented {
+			b = escapeEntry(d.key, delim, value, opts.Escape)
+			if commented {
+				b = escapeCommented(d.key, delim, value, comment, opts.Escape)
+			}
+		}
+		if e := write(b); e != nil {
+			return count, e
+		}
+		written[d.key] = true
+		count += 1
+	}
+	for _, key := range p.keys() {
+		if written[key] {
+			continue
+		}
+		if e := p.writeKeyComment(w, key, opts.Escape, eol); e != nil {
+			return count, e
+		}
+		value := p.data[key]
+		b := escapeEntry(key, delim, value, opts.Escape)
+		if comment, commented := p.inline[key]; commented {
+			b = escapeCommented(key, delim, value, comment, opts.Escape)
+		}
+		if e := write(b); e != nil {
+			return count, e
+		}
+		count += 1
+	}
+	return count, nil
+}
+
+// writeKeyComment writes the comment of key set by SetComment, if any, to w
+// as a comment block followed by eol.
+func (p *Table) writeKeyComment(w io.Writer, key string, mode EscapeMode, eol []byte) error {
+	if text, found := p.comments[key]; found {
+		return writeComment(w, text, mode, string(eol))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package properties
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDocument(t *testing.T) {
+	input := "# Server settings\r\n" +
+		"host = localhost\r\n" +
+		"\r\n" +
+		"! Ports\r\n" +
+		"port : 8080\r\n" +
+		"debug=true\r\n" +
+		"path = /usr/\\\r\n" +
+		"       local\r\n" +
+		"port = 8081\r\n"
+	p := NewTable()
+	n, e := p.LoadWith(strings.NewReader(input), LoadOptions{Document: true})
+	if n != 5 || e != nil {
+		t.Fatal("p.LoadWith(...) returned ", n, e)
+	}
+	var b bytes.Buffer
+	if n, e := p.StoreWith(&b, StoreOptions{LineSeparator: "\r\n"}); n != 4 || e != nil || b.String() != input {
+		t.Errorf("p.StoreWith(...) returned %d, %v, wrote %q", n, e, b.String())
+	}
+	p.Set("host", "example.com")
+	p.Delete("debug")
+	p.Set("added", "yes")
+	b.Reset()
+	want := "# Server settings\n" +
+		"host=example.com\n" +
+		"\n" +
+		"! Ports\n" +
+		"port : 8080\n" +
+		"path = /usr/\\\n" +
+		"       local\n" +
+		"port = 8081\n" +
+		"added=yes\n"
+	if n, e := p.Store(&b, false); n != 4 || e != nil || b.String() != want {
+		t.Errorf("p.Store(...) returned %d, %v, wrote %q", n, e, b.String())
+	}
+	q := NewTable()
+	q.Load(strings.NewReader(b.String()))
+	if !q.Equal(p) {
+		t.Error("the written document loaded as ", q.String())
+	}
+	p.Delete("port")
+	b.Reset()
+	want = "# Server settings\n" +
+		"host=example.com\n" +
+		"\n" +
+		"! Ports\n" +
+		"path = /usr/\\\n" +
+		"       local\n" +
+		"added=yes\n"
+	if n, e := p.Store(&b, false); n != 3 || e != nil || b.String() != want {
+		t.Errorf("p.Store(...) after p.Delete(\"port\") returned %d, %v, wrote %q", n, e, b.String())
+	}
+	p.Clear()
+	p.Set("a", "1")
+	b.Reset()
+	if p.Store(&b, false); b.String() != "a=1\n" {
+		t.Errorf("p.Store(...) after p.Clear() wrote %q", b.String())
+	}
+}
+
+func TestDocumentCycles(t *testing.T) {
+	input := "# Settings\nport=8080\n"
+	now := func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+	text := input
+	for i := 0; i < 3; i++ {
+		p := NewTable()
+		p.LoadWith(strings.NewReader(text), LoadOptions{Document: true})
+		var b strings.Builder
+		p.StoreWith(&b, StoreOptions{Header: "DO NOT EDIT", Footer: "end", Timestamp: true, Now: now})
+		text = b.String()
+	}
+	if text != input {
+		t.Errorf("p.StoreWith(...) wrote %q after 3 cycles", text)
+	}
+	for i := 0; i < 3; i++ {
+		p := NewTable()
+		p.LoadWith(strings.NewReader(text), LoadOptions{Document: true})
+		text, _ = p.SaveString("generated", false)
+	}
+	if text != input {
+		t.Errorf("p.SaveString(...) returned %q after 3 cycles", text)
+	}
+}
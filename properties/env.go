@@ -0,0 +1,223 @@
+package properties
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// OverrideFromEnv sets in the primary table the environment variables whose
+// names start with prefix, so that they override the properties loaded from
+// files. The name of each variable is turned into a key by removing the
+// prefix, converting it to lower case, and replacing every '_' by '.'. For
+// example, with the prefix "APP_", the variable APP_DB_HOST sets the key
+// "db.host". Conversely, a key is overridden by the variable named by the
+// prefix followed by the key in upper case, with every '.' replaced by '_'.
+// Keys holding upper case letters or '_' can't be overridden this way.
+// Variables whose name is the prefix alone are ignored. It returns the
+// number of properties set.
+func (p *Table) OverrideFromEnv(prefix string) int {
+	count := 0
+	for _, env := range os.Environ() {
+		i := strings.IndexByte(env, '=')
+		if i < 0 || !strings.HasPrefix(env[:i], prefix) || i == len(prefix) {
+			continue
+		}
+		key := strings.ReplaceAll(strings.ToLower(env[len(prefix):i]), "_", ".")
+		p.Set(key, env[i+1:])
+		count += 1
+	}
+	return count
+}
+
+// GetExpanded returns the value associated with key, as returned by Get, with
+// the references to environment variables, $VAR or ${VAR}, replaced by their
+// values. The undefined variables are replaced by the empty string, as a shell
+// does. A ${name} reference to a property found in the primary or in the
+// secondary table is kept unchanged: use ExpandEnv to expand both kinds of
+// references. A '$' not starting a reference is kept as it is.
+func (p *Table) GetExpanded(key string) string {
+	value, _, _ := p.expandEnv(p.Get(key))
+	return value
+}
+
+// GetExpandedStrict is like GetExpanded, but it returns an *ExpandError if
+// key isn't found or if the value refers to an undefined environment
+// variable.
+func (p *Table) GetExpandedStrict(key string) (string, error) {
+	value, found := p.Lookup(key)
+	if !found {
+		return "", &ExpandError{[]string{key}, ErrUnresolved}
+	}
+	value, name, undefined := p.expandEnv(value)
+	if undefined {
+		return "", &ExpandError{[]string{key, name}, ErrUnresolved}
+	}
+	return value, nil
+}
+
+// expandEnv returns s with the references to environment variables replaced
+// as described for GetExpanded, the name of the first undefined variable,
+// and whether there is one.
+func (p *Table) expandEnv(s string) (string, string, bool) {
+	var b strings.Builder
+	var first string
+	undefined := false
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 {
+			break
+		}
+		b.WriteString(s[:i])
+		name, n, braced := reference(s[i:], true)
+		if n == 0 {
+			b.WriteByte('$')
+			s = s[i+1:]
+			continue
+		}
+		ref := s[i : i+n]
+		s = s[i+n:]
+		if _, found := p.Lookup(name); braced && found {
+			b.WriteString(ref)
+			continue
+		}
+		value, found := os.LookupEnv(name)
+		if !found && !undefined {
+			first, undefined = name, true
+		}
+		b.WriteString(value)
+	}
+	b.WriteString(s)
+	return b.String(), first, undefined
+}
+
+// ExpandEnv is like Expand, but a ${name} reference to a property that can't
+// be found is replaced by the value of the environment variable name, if
+// defined, and a $NAME reference, NAME being made of ASCII letters, digits
+// and '_', is replaced by the value of the environment variable NAME. The
+// values of the environment variables are expanded in turn.
+// It returns an *ExpandError if key isn't found, if a reference can't be
+// resolved either as a property or as an environment variable, or if the
+// expansion of a property refers back to itself.
+func (p *Table) ExpandEnv(key string) (string, error) {
+	value, found := p.Lookup(key)
+	if !found {
+		return "", &ExpandError{[]string{key}, ErrUnresolved}
+	}
+	return expand(value, func(name string) (string, bool) {
+		if value, found := p.Lookup(name); found {
+			return value, true
+		}
+		return os.LookupEnv(name)
+	}, os.LookupEnv, []string{key})
+}
+
+// LoadEnv reads key-value pairs from r in the dotenv format, as found in the
+// .env files, which differs from the format read by Load. Each line holds a
+// key, a '=' and a value, possibly preceded by "export" and space. The space
+// around the key and the value is dropped. A line whose first non-space
+// character is '#' is a comment, and blank lines are ignored. A value may be
+// quoted:
+//   - between single quotes, the value is taken literally;
+//   - between double quotes, the sequences \n, \r, \t, \" and \\ are
+//     unescaped, and a '\' before any other character is kept;
+//   - without quotes, the value ends before a '#' preceded by space, which
+//     starts a comment.
+//
+// The text following a closing quote must be empty or a comment. The values
+// can't spread across several lines. A line that can't be parsed is reported
+// as a *LineError wrapping ErrSyntax, and the other lines are still loaded;
+// all the problems are returned together in an ErrorList.
+// The function returns the number of key-value pairs loaded and any error
+// encountered.
+func (p *Table) LoadEnv(r io.Reader) (int, error) {
+	reader := bufio.NewReader(r)
+	var errs ErrorList
+	count := 0
+	for line := 1; ; line++ {
+		s, e := reader.ReadString('\n')
+		if e != nil && e != io.EOF {
+			return count, e
+		}
+		t := strings.TrimSpace(s)
+		if t != "" && t[0] != '#' {
+			if rest, found := strings.CutPrefix(t, "export"); found && rest != "" && isSpace(rune(rest[0])) {
+				t = strings.TrimLeft(rest, " \t\f")
+			}
+			key, value, found := strings.Cut(t, "=")
+			key = strings.TrimSpace(key)
+			if found && key != "" {
+				value, found = parseEnvValue(strings.TrimLeft(value, " \t\f"))
+			}
+			if found && key != "" {
+				p.Set(key, value)
+				count += 1
+			} else {
+				errs = append(errs, &LineError{line, key, ErrSyntax})
+			}
+		}
+		if e == io.EOF {
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return count, errs
+	}
+	return count, nil
+}
+
+// parseEnvValue returns the value held by s, trimmed of its leading space,
+// as described for LoadEnv, and whether s is valid.
+func parseEnvValue(s string) (string, bool) {
+	if s == "" {
+		return "", true
+	}
+	var value string
+	var rest string
+	switch s[0] {
+	case '\'':
+		i := strings.IndexByte(s[1:], '\'')
+		if i < 0 {
+			return "", false
+		}
+		value, rest = s[1:i+1], s[i+2:]
+	case '"':
+		var b strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i += 1
+				switch s[i] {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				case '"', '\\':
+					b.WriteByte(s[i])
+				default:
+					b.WriteByte('\\')
+					b.WriteByte(s[i])
+				}
+				continue
+			}
+			b.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return "", false
+		}
+		value, rest = b.String(), s[i+1:]
+	default:
+		for i := 1; i < len(s); i++ {
+			if s[i] == '#' && isSpace(rune(s[i-1])) {
+				s = s[:i]
+				break
+			}
+		}
+		return strings.TrimRight(s, " \t\f"), true
+	}
+	rest = strings.TrimLeft(rest, " \t\f")
+	return value, rest == "" || rest[0] == '#'
+}
@@ -0,0 +1,128 @@
+package properties
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestOverrideFromEnv(t *testing.T) {
+	t.Setenv("PROPTEST_DB_HOST", "db.example.com")
+	t.Setenv("PROPTEST_PORT", "5432")
+	t.Setenv("PROPTEST_", "ignored")
+	d := NewTable()
+	d.Set("db.host", "localhost")
+	p := NewTableWith(d)
+	if n := p.OverrideFromEnv("PROPTEST_"); n != 2 {
+		t.Error("OverrideFromEnv() returned ", n)
+	}
+	if p.Get("db.host") != "db.example.com" {
+		t.Error(`p.Get("db.host") != "db.example.com"`)
+	}
+	if p.Get("port") != "5432" {
+		t.Error(`p.Get("port") != "5432"`)
+	}
+	if d.Get("db.host") != "localhost" {
+		t.Error(`d.Get("db.host") != "localhost"`)
+	}
+}
+
+func TestGetExpanded(t *testing.T) {
+	t.Setenv("PROPTEST_HOME", "/home/user")
+	p := NewTable()
+	p.Set("base", "/opt/app")
+	p.Set("cache", "$PROPTEST_HOME/cache")
+	p.Set("logs", "${PROPTEST_HOME}/logs/${PROPTEST_UNDEFINED}")
+	p.Set("data", "${base}/data")
+	p.Set("conf", "${base}/${PROPTEST_HOME}")
+	p.Set("mixed", "${base}/$PROPTEST_HOME/$5 costs $")
+	p.Set("bare", "$PROPTEST_UNDEFINED/x")
+	if s := p.GetExpanded("cache"); s != "/home/user/cache" {
+		t.Error(`p.GetExpanded("cache") returned `, s)
+	}
+	if s := p.GetExpanded("logs"); s != "/home/user/logs/" {
+		t.Error(`p.GetExpanded("logs") returned `, s)
+	}
+	if s, e := p.GetExpandedStrict("cache"); e != nil || s != "/home/user/cache" {
+		t.Error(`p.GetExpandedStrict("cache") returned `, s, e)
+	}
+	if _, e := p.GetExpandedStrict("logs"); !errors.Is(e, ErrUnresolved) || e.Error() != "properties: logs -> PROPTEST_UNDEFINED: unresolved reference" {
+		t.Error(`p.GetExpandedStrict("logs") returned `, e)
+	}
+	if _, e := p.GetExpandedStrict("missing"); !errors.Is(e, ErrUnresolved) {
+		t.Error(`p.GetExpandedStrict("missing") returned `, e)
+	}
+	if s, e := p.ExpandEnv("conf"); e != nil || s != "/opt/app//home/user" {
+		t.Error(`p.ExpandEnv("conf") returned `, s, e)
+	}
+	if _, e := p.Expand("conf"); !errors.Is(e, ErrUnresolved) {
+		t.Error(`p.Expand("conf") returned `, e)
+	}
+	if _, e := p.ExpandEnv("logs"); !errors.Is(e, ErrUnresolved) {
+		t.Error(`p.ExpandEnv("logs") returned `, e)
+	}
+	if s := p.GetExpanded("data"); s != "${base}/data" {
+		t.Error(`p.GetExpanded("data") returned `, s)
+	}
+	if s, e := p.GetExpandedStrict("data"); e != nil || s != "${base}/data" {
+		t.Error(`p.GetExpandedStrict("data") returned `, s, e)
+	}
+	if s := p.GetExpanded("mixed"); s != "${base}//home/user/ costs $" {
+		t.Error(`p.GetExpanded("mixed") returned `, s)
+	}
+	t.Setenv("5", "five")
+	if s, e := p.ExpandEnv("mixed"); e != nil || s != "/opt/app//home/user/five costs $" {
+		t.Error(`p.ExpandEnv("mixed") returned `, s, e)
+	}
+	if s, e := p.Expand("mixed"); e != nil || s != "/opt/app/$PROPTEST_HOME/$5 costs $" {
+		t.Error(`p.Expand("mixed") returned `, s, e)
+	}
+	if _, e := p.ExpandEnv("bare"); !errors.Is(e, ErrUnresolved) || e.Error() != "properties: bare -> PROPTEST_UNDEFINED: unresolved reference" {
+		t.Error(`p.ExpandEnv("bare") returned `, e)
+	}
+}
+
+func TestLoadEnv(t *testing.T) {
+	input := "# database\r\n" +
+		"DB_HOST=localhost\r\n" +
+		"export DB_PORT = 5432 # default\r\n" +
+		"\n" +
+		"PASSWORD='p@ss #1 \\n'\n" +
+		"GREETING=\"Hello,\\t\\\"World\\\"\\n\" # quoted\n" +
+		"PATH_LIST=\"C:\\dir\"\n" +
+		"EMPTY=\n" +
+		"HASH=a#b\n" +
+		"exported=1\n" +
+		"BROKEN\n" +
+		"UNTERMINATED=\"abc\n" +
+		"TRAILING='x' y\n" +
+		"LAST=end"
+	p := NewTable()
+	n, e := p.LoadEnv(strings.NewReader(input))
+	var errs ErrorList
+	if n != 9 || !errors.As(e, &errs) || len(errs) != 3 || !errors.Is(e, ErrSyntax) {
+		t.Fatal("p.LoadEnv(...) returned ", n, e)
+	}
+	if errs[0].Error() != `properties: line 11: "BROKEN": not a key-value pair` {
+		t.Error("errs[0] is ", errs[0])
+	}
+	want := map[string]string{
+		"DB_HOST":   "localhost",
+		"DB_PORT":   "5432",
+		"PASSWORD":  "p@ss #1 \\n",
+		"GREETING":  "Hello,\t\"World\"\n",
+		"PATH_LIST": "C:\\dir",
+		"EMPTY":     "",
+		"HASH":      "a#b",
+		"exported":  "1",
+		"LAST":      "end",
+	}
+	for key, value := range want {
+		if s, found := p.Lookup(key); !found || s != value {
+			t.Errorf("p.Lookup(%q) returned %q, %v", key, s, found)
+		}
+	}
+	if p.Len() != len(want) {
+		t.Errorf("p.LoadEnv(...) loaded %q", p.String())
+	}
+}
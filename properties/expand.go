@@ -0,0 +1,255 @@
+package properties
+
+import (
+	"errors"
+	"strings"
+	"text/template"
+)
+
+// ErrUnresolved is reported when a property, or a ${name} reference in the
+// value of a property, can't be found in the table.
+var ErrUnresolved = errors.New("unresolved reference")
+
+// ErrCycle is reported when the expansion of a property refers, directly or
+// through other properties, back to itself.
+var ErrCycle = errors.New("cyclic reference")
+
+// ErrTooDeep is reported when the expansion of a property nests more than 32
+// references.
+var ErrTooDeep = errors.New("expansion too deep")
+
+// maxDepth is the maximum number of nested references followed by an
+// expansion.
+const maxDepth = 32
+
+// ExpandError records a failed expansion of a property value. Chain holds
+// the names followed during the expansion, starting with the expanded key
+// and ending with the reference that couldn't be expanded.
+type ExpandError struct {
+	Chain []string
+	Err   error
+}
+
+// Error returns the chain of references and the reason of the failure.
+func (e *ExpandError) Error() string {
+	return "properties: " + strings.Join(e.Chain, " -> ") + ": " + e.Err.Error()
+}
+
+// Unwrap returns the reason of the failure: ErrUnresolved, ErrCycle or
+// ErrTooDeep.
+func (e *ExpandError) Unwrap() error {
+	return e.Err
+}
+
+// reference parses the reference at the start of s, which starts with a
+// '$': a name enclosed in braces, as in "${name}", or, if bare is true, a
+// name made of ASCII letters, digits and '_', as in "$NAME". It returns the
+// name, the length of the reference, and whether the name is enclosed in
+// braces. The length is 0 if s doesn't start with a reference.
+func reference(s string, bare bool) (string, int, bool) {
+	if strings.HasPrefix(s, "${") {
+		if j := strings.IndexByte(s, '}'); j >= 0 {
+			return s[2:j], j + 1, true
+		}
+		return "", 0, false
+	}
+	n := 1
+	for bare && n < len(s) && isNameByte(s[n]) {
+		n += 1
+	}
+	if n == 1 {
+		return "", 0, false
+	}
+	return s[1:n], n, false
+}
+
+// isNameByte reports whether c may be part of a $NAME reference.
+func isNameByte(c byte) bool {
+	return c == '_' || ('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// expand replaces every ${name} reference in s by the expanded value of name,
+// as returned by lookup. If bare isn't nil, every $NAME reference is replaced
+// by the expanded value returned by bare. The chain holds the names already
+// being expanded, it is used to detect the cyclic references and to bound the
+// nesting of the references. A '$' not starting a reference and a "${"
+// without a closing '}' are copied unchanged.
+func expand(s string, lookup, bare func(string) (string, bool), chain []string) (string, error) {
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 {
+			break
+		}
+		b.WriteString(s[:i])
+		name, n, braced := reference(s[i:], bare != nil)
+		if n == 0 {
+			b.WriteByte('$')
+			s = s[i+1:]
+			continue
+		}
+		s = s[i+n:]
+		next := append(chain[:len(chain):len(chain)], name)
+		for _, c := range chain {
+			if c == name {
+				return "", &ExpandError{next, ErrCycle}
+			}
+		}
+		if len(next) > maxDepth {
+			return "", &ExpandError{next, ErrTooDeep}
+		}
+		resolve := lookup
+		if !braced {
+			resolve = bare
+		}
+		value, found := resolve(name)
+		if !found {
+			return "", &ExpandError{next, ErrUnresolved}
+		}
+		value, e := expand(value, lookup, bare, next)
+		if e != nil {
+			return "", e
+		}
+		b.WriteString(value)
+	}
+	b.WriteString(s)
+	return b.String(), nil
+}
+
+// Expand returns the value associated with key, with every ${name} reference
+// replaced by the expanded value of the property name. The key and the
+// referenced properties are searched in the primary and in the secondary
+// tables. A '$' not followed by '{' and a "${" without a closing '}' are
+// kept as they are.
+// It returns an *ExpandError if key isn't found, if a reference can't be
+// resolved, if the expansion of a property refers back to itself, or if the
+// references are nested more than 32 levels deep.
+func (p *Table) Expand(key string) (string, error) {
+	value, found := p.Lookup(key)
+	if !found {
+		return "", &ExpandError{[]string{key}, ErrUnresolved}
+	}
+	return expand(value, p.Lookup, nil, []string{key})
+}
+
+// ExpandWith returns the value associated with key, expanded as done by
+// Expand, except that each ${name} reference is first passed to resolve: if
+// it returns true, the value it returns is used, otherwise name is searched
+// in the primary and in the secondary tables. This allows resolving the
+// references from other sources, like the environment or a secret store,
+// before the table. The values returned by resolve are expanded in turn. The
+// key itself is searched only in the tables. If resolve is nil, ExpandWith
+// is equivalent to Expand.
+// It returns an *ExpandError if key isn't found, if a reference can't be
+// resolved, if the expansion refers back to a name being expanded, whether
+// the value comes from resolve or from the tables, or if the references are
+// nested more than 32 levels deep.
+func (p *Table) ExpandWith(key string, resolve func(name string) (string, bool)) (string, error) {
+	value, found := p.Lookup(key)
+	if !found {
+		return "", &ExpandError{[]string{key}, ErrUnresolved}
+	}
+	if resolve == nil {
+		return expand(value, p.Lookup, nil, []string{key})
+	}
+	lookup := func(name string) (string, bool) {
+		if value, found := resolve(name); found {
+			return value, true
+		}
+		return p.Lookup(name)
+	}
+	return expand(value, lookup, nil, []string{key})
+}
+
+// ValidateInterpolation expands the values of all the properties found in
+// the primary and in the secondary tables. It returns nil if every value can
+// be expanded. Otherwise, it returns an ErrorList holding an *ExpandError for
+// each property that failed, in the lexicographic order of the keys.
+func (p *Table) ValidateInterpolation() error {
+	data := p.flatten()
+	var errs ErrorList
+	for _, key := range sortedKeys(data) {
+		if _, e := expand(data[key], p.Lookup, nil, []string{key}); e != nil {
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ResolvedSubset returns the properties whose keys start with prefix, with the
+// prefix removed from the keys and the values expanded as done by Expand.
+// The properties are gathered from the primary and the secondary tables,
+// each key appearing once with the value found by Lookup. If some values
+// can't be expanded, it returns nil and an ErrorList holding an *ExpandError
+// for each of them, in the lexicographic order of the keys.
+func (p *Table) ResolvedSubset(prefix string) (map[string]string, error) {
+	data := p.flatten()
+	subset := make(map[string]string)
+	var errs ErrorList
+	for _, key := range sortedKeys(data) {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		value, e := expand(data[key], p.Lookup, nil, []string{key})
+		if e != nil {
+			errs = append(errs, e)
+			continue
+		}
+		subset[key[len(prefix):]] = value
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return subset, nil
+}
+
+// GetTemplate returns the value associated with key, executed as a template
+// of the text/template package. The data passed to the template is the map
+// of the properties found by Lookup, so that {{.base}} is replaced by the
+// value of "base", and {{index . "db.host"}} by the value of "db.host".
+// Referring to a missing property is an error. The template function prop,
+// as in {{prop "base"}}, returns the value of the named property, executed
+// in turn as a template. Only the values reached by GetTemplate and prop are
+// executed, the other values are never interpreted as templates.
+// It returns an *ExpandError if key (or a property named by prop) isn't
+// found, if a template refers back to itself through prop, or if prop calls
+// are nested more than 32 levels deep. Otherwise, it returns the errors of
+// parsing and executing the templates.
+func (p *Table) GetTemplate(key string) (string, error) {
+	return p.execute(p.flatten(), []string{key})
+}
+
+// execute executes as a template the value of the last key in chain, taken
+// from data. The chain holds the keys whose templates are being executed.
+func (p *Table) execute(data map[string]string, chain []string) (string, error) {
+	key := chain[len(chain)-1]
+	for _, c := range chain[:len(chain)-1] {
+		if c == key {
+			return "", &ExpandError{chain, ErrCycle}
+		}
+	}
+	if len(chain) > maxDepth {
+		return "", &ExpandError{chain, ErrTooDeep}
+	}
+	value, found := data[key]
+	if !found {
+		return "", &ExpandError{chain, ErrUnresolved}
+	}
+	t := template.New(key).Option("missingkey=error")
+	t.Funcs(template.FuncMap{
+		"prop": func(name string) (string, error) {
+			return p.execute(data, append(chain[:len(chain):len(chain)], name))
+		},
+	})
+	if _, e := t.Parse(value); e != nil {
+		return "", e
+	}
+	var b strings.Builder
+	if e := t.Execute(&b, data); e != nil {
+		return "", e
+	}
+	return b.String(), nil
+}
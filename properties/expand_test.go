@@ -0,0 +1,143 @@
+package properties
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	d := NewTable()
+	d.Set("base", "/opt/app")
+	p := NewTableWith(d)
+	p.Set("logs", "${base}/logs")
+	p.Set("current", "${logs}/current.log")
+	p.Set("price", "$5 or ${unterminated")
+	if s, e := p.Expand("current"); e != nil || s != "/opt/app/logs/current.log" {
+		t.Error(`p.Expand("current") returned `, s, e)
+	}
+	if s, e := p.Expand("price"); e != nil || s != "$5 or ${unterminated" {
+		t.Error(`p.Expand("price") returned `, s, e)
+	}
+	p.Set("loop", "${loop}")
+	if _, e := p.Expand("loop"); !errors.Is(e, ErrCycle) {
+		t.Error(`p.Expand("loop") returned `, e)
+	}
+	if _, e := p.Expand("missing"); !errors.Is(e, ErrUnresolved) {
+		t.Error(`p.Expand("missing") returned `, e)
+	}
+}
+
+func TestValidateInterpolation(t *testing.T) {
+	p := NewTable()
+	p.Set("a", "${b}")
+	p.Set("b", "${a}")
+	p.Set("c", "${nowhere}")
+	p.Set("d", "plain")
+	e := p.ValidateInterpolation()
+	var errs ErrorList
+	if !errors.As(e, &errs) || len(errs) != 3 {
+		t.Fatal("ValidateInterpolation() returned ", e)
+	}
+	if errs[0].Error() != "properties: a -> b -> a: cyclic reference" {
+		t.Error("errs[0] is ", errs[0])
+	}
+	if errs[2].Error() != "properties: c -> nowhere: unresolved reference" {
+		t.Error("errs[2] is ", errs[2])
+	}
+	p.Set("c", "${d}")
+	p.Delete("a")
+	p.Delete("b")
+	if e := p.ValidateInterpolation(); e != nil {
+		t.Error("ValidateInterpolation() returned ", e)
+	}
+}
+
+func TestResolvedSubset(t *testing.T) {
+	d := NewTable()
+	d.Set("base", "/opt/app")
+	d.Set("db.host", "localhost")
+	d.Set("db.data", "${base}/db")
+	p := NewTableWith(d)
+	p.Set("db.host", "example.com")
+	p.Set("cache.dir", "${base}/cache")
+	m, e := p.ResolvedSubset("db.")
+	if e != nil || len(m) != 2 || m["host"] != "example.com" || m["data"] != "/opt/app/db" {
+		t.Error(`p.ResolvedSubset("db.") returned `, m, e)
+	}
+	p.Set("db.url", "${db.scheme}://${db.host}")
+	m, e = p.ResolvedSubset("db.")
+	if m != nil || !errors.Is(e, ErrUnresolved) {
+		t.Error(`p.ResolvedSubset("db.") returned `, m, e)
+	}
+}
+
+func TestGetTemplate(t *testing.T) {
+	p := NewTable()
+	p.Set("base", "/opt/app")
+	p.Set("db.host", "localhost")
+	p.Set("logs", "{{.base}}/logs")
+	p.Set("current", `{{prop "logs"}}/current.log on {{index . "db.host"}}`)
+	p.Set("mode", `{{if eq .debug "true"}}verbose{{else}}quiet{{end}}`)
+	p.Set("debug", "true")
+	if s, e := p.GetTemplate("current"); e != nil || s != "/opt/app/logs/current.log on localhost" {
+		t.Error(`p.GetTemplate("current") returned `, s, e)
+	}
+	if s, e := p.GetTemplate("mode"); e != nil || s != "verbose" {
+		t.Error(`p.GetTemplate("mode") returned `, s, e)
+	}
+	if s := p.Get("logs"); s != "{{.base}}/logs" {
+		t.Error(`p.Get("logs") returned `, s)
+	}
+	p.Set("loop", `{{prop "loop"}}`)
+	if _, e := p.GetTemplate("loop"); !errors.Is(e, ErrCycle) {
+		t.Error(`p.GetTemplate("loop") returned `, e)
+	}
+	p.Set("missing", "{{.nowhere}}")
+	if _, e := p.GetTemplate("missing"); e == nil {
+		t.Error(`p.GetTemplate("missing") returned no error`)
+	}
+	for i := 0; i < 40; i++ {
+		p.Set(fmt.Sprint("deep", i), fmt.Sprintf(`{{prop "deep%d"}}`, i+1))
+	}
+	if _, e := p.GetTemplate("deep0"); !errors.Is(e, ErrTooDeep) {
+		t.Error(`p.GetTemplate("deep0") returned `, e)
+	}
+}
+
+func TestExpandWith(t *testing.T) {
+	p := NewTable()
+	p.Set("home", "/home/${user}")
+	p.Set("user", "table")
+	p.Set("url", "https://${secret.token}@${host}")
+	p.Set("host", "example.com")
+	env := map[string]string{"user": "env", "secret.token": "${token.prefix}-42", "token.prefix": "abc"}
+	resolve := func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	}
+	if s, e := p.ExpandWith("home", resolve); e != nil || s != "/home/env" {
+		t.Error(`p.ExpandWith("home", ...) returned `, s, e)
+	}
+	if s, e := p.ExpandWith("url", resolve); e != nil || s != "https://abc-42@example.com" {
+		t.Error(`p.ExpandWith("url", ...) returned `, s, e)
+	}
+	if s, e := p.ExpandWith("home", nil); e != nil || s != "/home/table" {
+		t.Error(`p.ExpandWith("home", nil) returned `, s, e)
+	}
+	env["host"] = "${url}"
+	_, e := p.ExpandWith("url", resolve)
+	var ee *ExpandError
+	if !errors.As(e, &ee) || !errors.Is(e, ErrCycle) || e.Error() != "properties: url -> host -> url: cyclic reference" {
+		t.Error(`p.ExpandWith("url", ...) returned `, e)
+	}
+	deep := func(name string) (string, bool) {
+		return "${" + name + "x}", true
+	}
+	if _, e := p.ExpandWith("home", deep); !errors.Is(e, ErrTooDeep) {
+		t.Error(`p.ExpandWith("home", ...) returned `, e)
+	}
+	if _, e := p.ExpandWith("missing", resolve); !errors.Is(e, ErrUnresolved) {
+		t.Error(`p.ExpandWith("missing", ...) returned `, e)
+	}
+}
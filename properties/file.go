@@ -0,0 +1,81 @@
+package properties
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// OpenReader creates a new property table with no secondary table and loads
+// it from r, as done by Load. It always returns a usable table: if an error
+// is encountered, the table holds the key-value pairs loaded before the
+// error, and the error is returned along with it.
+func OpenReader(r io.Reader) (*Table, error) {
+	p := NewTable()
+	_, e := p.Load(r)
+	return p, e
+}
+
+// Open creates a new property table with no secondary table and loads it
+// from the named file. Like OpenReader, it always returns a usable table,
+// holding the key-value pairs loaded before any error. If the file can't be
+// opened, the table is empty.
+func Open(path string) (*Table, error) {
+	p := NewTable()
+	_, e := p.LoadFile(path)
+	return p, e
+}
+
+// LoadFile reads key-value pairs from the named file into the table, as
+// done by Load. The file is closed before returning, even if an error is
+// encountered.
+// The function returns the number of key-value pairs loaded and any error
+// encountered, including the error opening the file.
+func (p *Table) LoadFile(path string) (int, error) {
+	f, e := os.Open(path)
+	if e != nil {
+		return 0, e
+	}
+	defer f.Close()
+	return p.Load(f)
+}
+
+// SaveFile writes the table to the named file, as done by Save. The file is
+// replaced atomically: the table is written to a temporary file in the same
+// directory, which is synced to the disk and then renamed to path, so that a
+// crash while writing never leaves a truncated file behind. The file keeps the
+// permissions of the file it replaces; a new file gets the permissions 0644.
+// If an error is encountered, the temporary file is removed, any existing file
+// is left unchanged, and the table is still marked as modified if it was. The
+// function returns the number of key-value pairs written and any error
+// encountered.
+func (p *Table) SaveFile(path, comments string, ascii bool) (int, error) {
+	mode := os.FileMode(0644)
+	if info, e := os.Stat(path); e == nil {
+		mode = info.Mode().Perm()
+	}
+	f, e := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if e != nil {
+		return 0, e
+	}
+	dirty := p.dirty
+	count, e := p.Save(f, comments, ascii)
+	if e == nil {
+		e = f.Sync()
+	}
+	if e == nil {
+		e = f.Chmod(mode)
+	}
+	if e2 := f.Close(); e == nil {
+		e = e2
+	}
+	if e == nil {
+		e = os.Rename(f.Name(), path)
+	}
+	if e != nil {
+		os.Remove(f.Name())
+		p.dirty = dirty
+		return count, e
+	}
+	return count, nil
+}
@@ -0,0 +1,85 @@
+package properties
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.properties")
+	if e := os.WriteFile(path, []byte("key = value\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	p, e := Open(path)
+	if e != nil || p.Get("key") != "value" {
+		t.Error("Open() returned ", p, e)
+	}
+	p, e = Open(filepath.Join(t.TempDir(), "missing.properties"))
+	if e == nil || p == nil || p.String() != "" {
+		t.Error("Open() returned ", p, e)
+	}
+	p, e = OpenReader(strings.NewReader("other:value"))
+	if e != nil || p.Get("other") != "value" {
+		t.Error("OpenReader() returned ", p, e)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.properties")
+	if e := os.WriteFile(path, []byte("a=1\nb=2\n"), 0644); e != nil {
+		t.Fatal(e)
+	}
+	p := NewTable()
+	p.Set("c", "3")
+	if n, e := p.LoadFile(path); n != 2 || e != nil {
+		t.Error("LoadFile() returned ", n, e)
+	}
+	if p.Len() != 3 || p.Get("a") != "1" || p.Get("b") != "2" {
+		t.Error("LoadFile() loaded ", p)
+	}
+	n, e := p.LoadFile(filepath.Join(t.TempDir(), "missing.properties"))
+	if n != 0 || !errors.Is(e, fs.ErrNotExist) {
+		t.Error("LoadFile() returned ", n, e)
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.properties")
+	p := NewTable()
+	p.Set("b", "2")
+	p.Set("a", "1")
+	if n, e := p.SaveFile(path, "header", false); n != 2 || e != nil || p.Dirty() {
+		t.Error("SaveFile() returned ", n, e)
+	}
+	b, e := os.ReadFile(path)
+	if e != nil || string(b) != "#header\na=1\nb=2\n" {
+		t.Error("SaveFile() wrote ", string(b), e)
+	}
+	if e := os.Chmod(path, 0600); e != nil {
+		t.Fatal(e)
+	}
+	p.Set("c", "3")
+	if n, e := p.SaveFile(path, "", false); n != 3 || e != nil {
+		t.Error("SaveFile() returned ", n, e)
+	}
+	if info, e := os.Stat(path); e != nil || info.Mode().Perm() != 0600 {
+		t.Error("SaveFile() didn't keep the permissions: ", info.Mode(), e)
+	}
+	q, e := Open(path)
+	if e != nil || !q.Equal(p) {
+		t.Error("Open() returned ", q, e)
+	}
+	p.Set("d", "4")
+	if _, e := p.SaveFile(filepath.Join(dir, "missing", "test.properties"), "", false); e == nil || !p.Dirty() {
+		t.Error("SaveFile() into a missing directory returned ", e)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Error("SaveFile() left files behind: ", entries)
+	}
+}
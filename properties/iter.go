@@ -0,0 +1,60 @@
+package properties
+
+import "iter"
+
+// All returns an iterator over the key-value pairs of the primary table, in
+// no particular order. The pairs of the secondary table are not included.
+// The iteration stops as soon as the loop using it is left.
+func (p *Table) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for key, value := range p.data {
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// AllWithDefaults returns an iterator over the key-value pairs found by
+// Lookup, in the primary table, in the secondary tables and among the
+// fallback values, in no particular order. Each key is yielded once, with the
+// value found by Lookup. The pairs are gathered when the iteration starts,
+// and the iteration stops as soon as the loop using it is left.
+func (p *Table) AllWithDefaults() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for key, value := range p.flatten() {
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
+
+// ForEach calls fn for each key-value pair of the primary table, in the
+// order used by Store: in insertion order in the ordered mode, in
+// lexicographic order otherwise. It stops as soon as fn returns false. The
+// pairs of the secondary table are not included. The keys are collected
+// before the first call, so fn may modify the table: the pairs it sets
+// aren't visited, and the pairs it deletes are visited with the value they
+// had before.
+func (p *Table) ForEach(fn func(key, value string) bool) {
+	for _, key := range p.keys() {
+		if !fn(key, p.data[key]) {
+			return
+		}
+	}
+}
+
+// ForEachResolved calls fn for each key found by Lookup, in the primary
+// table, in the secondary tables and among the fallback values, in
+// lexicographic order, with the value found by Lookup, so that each key is
+// visited once even if it's present in several of them. It stops as soon as
+// fn returns false.
+func (p *Table) ForEachResolved(fn func(key, value string) bool) {
+	data := p.flatten()
+	for _, key := range sortedKeys(data) {
+		if !fn(key, data[key]) {
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package properties
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAll(t *testing.T) {
+	d := NewTable()
+	d.Set("a", "default")
+	d.Set("b", "2")
+	p := NewTableWith(d)
+	p.Set("a", "1")
+	p.Set("c", "3")
+	p.SetFallback("f", "0")
+	found := map[string]string{}
+	for key, value := range p.All() {
+		found[key] = value
+	}
+	if len(found) != 2 || found["a"] != "1" || found["c"] != "3" {
+		t.Error("All() yielded ", found)
+	}
+	found = map[string]string{}
+	for key, value := range p.AllWithDefaults() {
+		found[key] = value
+	}
+	if len(found) != 4 || found["a"] != "1" || found["b"] != "2" || found["c"] != "3" || found["f"] != "0" {
+		t.Error("AllWithDefaults() yielded ", found)
+	}
+	count := 0
+	for range p.AllWithDefaults() {
+		count += 1
+		break
+	}
+	if count != 1 {
+		t.Error("AllWithDefaults() didn't stop, count is ", count)
+	}
+}
+
+func TestForEach(t *testing.T) {
+	d := NewTable()
+	d.Set("a", "default")
+	d.Set("b", "2")
+	p := NewTableWith(d)
+	p.SetOrdered(true)
+	p.Set("c", "3")
+	p.Set("a", "1")
+	d.SetFallback("f", "0")
+	var visited []string
+	p.ForEach(func(key, value string) bool {
+		visited = append(visited, key+"="+value)
+		return true
+	})
+	if len(visited) != 2 || visited[0] != "c=3" || visited[1] != "a=1" {
+		t.Error("ForEach() visited ", visited)
+	}
+	visited = nil
+	p.ForEachResolved(func(key, value string) bool {
+		visited = append(visited, key+"="+value)
+		return true
+	})
+	if !slices.Equal(visited, []string{"a=1", "b=2", "c=3", "f=0"}) {
+		t.Error("ForEachResolved() visited ", visited)
+	}
+	count := 0
+	p.ForEach(func(key, value string) bool {
+		count += 1
+		return false
+	})
+	p.ForEachResolved(func(key, value string) bool {
+		count += 1
+		return false
+	})
+	if count != 2 {
+		t.Error("ForEach() didn't stop, count is ", count)
+	}
+}
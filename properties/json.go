@@ -0,0 +1,45 @@
+package properties
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// MarshalJSON implements the json.Marshaler interface. It returns the
+// key-value pairs of the primary table as a JSON object whose members are
+// all strings, in the lexicographic order of the keys. The pairs of the
+// secondary table are not included.
+func (p *Table) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.ToMap())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface. It reads a JSON
+// object whose members are all strings, and replaces the key-value pairs of
+// the primary table by the members of the object. The secondary table is
+// left unchanged. If a member isn't a string, the error names its key and
+// the table is left unchanged; the values aren't converted to strings. As
+// usual, the JSON null leaves the table unchanged.
+func (p *Table) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(bytes.TrimSpace(b), []byte("null")) {
+		return nil
+	}
+	var raw map[string]json.RawMessage
+	if e := json.Unmarshal(b, &raw); e != nil {
+		return e
+	}
+	data := make(map[string]string, len(raw))
+	for _, key := range slices.Sorted(maps.Keys(raw)) {
+		value := raw[key]
+		var s string
+		if e := json.Unmarshal(value, &s); e != nil || bytes.Equal(value, []byte("null")) {
+			return keyError(key, fmt.Errorf("JSON value %s is not a string", value))
+		}
+		data[key] = s
+	}
+	p.Clear()
+	p.SetAll(data)
+	return nil
+}
@@ -0,0 +1,40 @@
+package properties
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	d := NewTable()
+	d.Set("default", "ignored")
+	p := NewTableWith(d)
+	p.Set("b", "2")
+	p.Set("a", "\"quoted\"")
+	b, e := json.Marshal(struct{ Config *Table }{p})
+	if e != nil || string(b) != `{"Config":{"a":"\"quoted\"","b":"2"}}` {
+		t.Error("json.Marshal() returned ", string(b), e)
+	}
+	q := NewTableWith(d)
+	q.Set("old", "removed")
+	if e := json.Unmarshal([]byte(`{"a":"1","b":""}`), q); e != nil {
+		t.Error("json.Unmarshal() returned ", e)
+	}
+	if q.Len() != 2 || q.Get("a") != "1" || q.Get("b") != "" || q.Get("default") != "ignored" {
+		t.Error("json.Unmarshal() loaded ", q)
+	}
+	for _, s := range []string{`{"a":"x","n":1}`, `{"a":"x","n":null}`, `{"a":"x","n":{"b":"c"}}`} {
+		e := json.Unmarshal([]byte(s), q)
+		if e == nil || !strings.Contains(e.Error(), `"n"`) || q.Get("a") != "1" {
+			t.Errorf("json.Unmarshal(%s) returned %v", s, e)
+		}
+	}
+	if e := json.Unmarshal([]byte(`["a"]`), q); e == nil || q.Len() != 2 {
+		t.Error("json.Unmarshal() of an array returned ", e)
+	}
+	var r struct{ Config Table }
+	if e := json.Unmarshal([]byte(`{"Config":{"k":"v"}}`), &r); e != nil || r.Config.Get("k") != "v" {
+		t.Error("json.Unmarshal() into a zero table returned ", e)
+	}
+}
@@ -0,0 +1,203 @@
+package properties
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ErrUnsupportedType is reported by Unmarshal and Marshal for a struct field
+// whose type can't be converted from or to a property value.
+var ErrUnsupportedType = errors.New("unsupported field type")
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// fieldKey returns the key of the property matching the struct field f: the
+// name given by the prop tag of f, or the name of f if it has no such tag.
+// It returns false if f is unexported or if its tag is "-".
+func fieldKey(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	key, found := f.Tag.Lookup("prop")
+	if !found || key == "" {
+		return f.Name, true
+	}
+	return key, key != "-"
+}
+
+// structValue returns the struct pointed to by v, or an error if v isn't a
+// non-nil pointer to a struct.
+func structValue(v any) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("properties: %T isn't a non-nil pointer to a struct", v)
+	}
+	return rv.Elem(), nil
+}
+
+// setField converts s to the type of the field v and stores it in v. The
+// booleans are parsed as by p.GetBool.
+func setField(p *Table, v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, e := time.ParseDuration(s)
+		if e != nil {
+			return e
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, e := p.parseBool(s)
+		if e != nil {
+			return e
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, e := strconv.ParseInt(s, 10, v.Type().Bits())
+		if e != nil {
+			return e
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, e := strconv.ParseUint(s, 10, v.Type().Bits())
+		if e != nil {
+			return e
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, e := strconv.ParseFloat(s, v.Type().Bits())
+		if e != nil {
+			return e
+		}
+		v.SetFloat(f)
+	default:
+		return ErrUnsupportedType
+	}
+	return nil
+}
+
+// formatField returns the property value holding the value of the field v,
+// in the form read back by setField.
+func formatField(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	}
+	return v.String()
+}
+
+// supported reports whether the values of type t can be converted from and
+// to property values.
+func supported(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// Unmarshal stores the properties of p into the fields of the struct pointed
+// to by v. Each exported field is set from the property named by its prop
+// tag, as in `prop:"db.host"`, or by the name of the field if it has no such
+// tag. The fields tagged `prop:"-"` are skipped. The properties are searched
+// in the primary and in the secondary tables. If a property isn't found, the
+// field is set from its default tag, as in `default:"5432"`, if present, and
+// is left unchanged otherwise.
+// The fields may be strings, booleans (parsed as by GetBool), integers,
+// unsigned integers and floating-point numbers of any size (parsed by the
+// strconv package), and time.Duration values (parsed by time.ParseDuration).
+// The fields of any other type are reported with an error wrapping
+// ErrUnsupportedType, even if the property isn't found.
+// It returns an error if v isn't a non-nil pointer to a struct. Otherwise,
+// it sets all the fields it can and returns an ErrorList holding an error for
+// each field that failed, naming the field and the key, in the order of the
+// fields, or nil if every field succeeded.
+func Unmarshal(p *Table, v any) error {
+	rv, e := structValue(v)
+	if e != nil {
+		return e
+	}
+	var errs ErrorList
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		key, found := fieldKey(f)
+		if !found {
+			continue
+		}
+		if !supported(f.Type) {
+			errs = append(errs, fmt.Errorf("properties: field %s (%q): %w %s", f.Name, key, ErrUnsupportedType, f.Type))
+			continue
+		}
+		value, found := p.Lookup(key)
+		if !found {
+			value, found = f.Tag.Lookup("default")
+		}
+		if !found {
+			continue
+		}
+		if e := setField(p, rv.Field(i), value); e != nil {
+			errs = append(errs, fmt.Errorf("properties: field %s (%q): %w", f.Name, key, e))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Marshal returns a new table holding the values of the fields of v, which
+// must be a struct or a non-nil pointer to a struct. Each exported field is
+// stored under the key named by its prop tag, or under the name of the field
+// if it has no such tag, as read back by Unmarshal. The fields tagged
+// `prop:"-"` are skipped, and the default tags are ignored. The fields must
+// have the types supported by Unmarshal. The booleans are formatted as "true"
+// or "false", the numbers in decimal, the floating-point numbers in the
+// shortest form read back exactly, and the time.Duration values as by their
+// String method.
+// If some fields have other types, it returns nil and an ErrorList holding an
+// error wrapping ErrUnsupportedType for each of them, naming the field and
+// the key, in the order of the fields.
+func Marshal(v any) (*Table, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("properties: %T isn't a struct or a non-nil pointer to a struct", v)
+	}
+	p := NewTable()
+	var errs ErrorList
+	for i := 0; i < rv.NumField(); i++ {
+		f := rv.Type().Field(i)
+		key, found := fieldKey(f)
+		if !found {
+			continue
+		}
+		if !supported(f.Type) {
+			errs = append(errs, fmt.Errorf("properties: field %s (%q): %w %s", f.Name, key, ErrUnsupportedType, f.Type))
+			continue
+		}
+		p.Set(key, formatField(rv.Field(i)))
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return p, nil
+}
@@ -0,0 +1,90 @@
+package properties
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type config struct {
+	Host    string        `prop:"db.host"`
+	Port    uint16        `prop:"db.port" default:"5432"`
+	Debug   bool          `prop:"debug"`
+	Ratio   float64       `prop:"ratio"`
+	Timeout time.Duration `prop:"timeout" default:"30s"`
+	Retries int8
+	Name    string `prop:"name"`
+	Skipped string `prop:"-"`
+	hidden  string
+}
+
+func TestUnmarshal(t *testing.T) {
+	d := NewTable()
+	d.Set("db.host", "localhost")
+	d.Set("debug", "yes")
+	p := NewTableWith(d)
+	p.Set("db.host", "example.com")
+	p.Set("ratio", "0.75")
+	p.Set("Retries", "-3")
+	p.Set("Skipped", "no")
+	p.Set("hidden", "no")
+	c := config{Name: "unchanged"}
+	if e := Unmarshal(p, &c); e != nil {
+		t.Fatal("Unmarshal() returned ", e)
+	}
+	want := config{"example.com", 5432, true, 0.75, 30 * time.Second, -3, "unchanged", "", ""}
+	if c != want {
+		t.Errorf("Unmarshal() stored %+v", c)
+	}
+	p.Set("db.port", "70000")
+	p.Set("timeout", "soon")
+	e := Unmarshal(p, &c)
+	var errs ErrorList
+	if !errors.As(e, &errs) || len(errs) != 2 || !errors.Is(e, strconv.ErrRange) {
+		t.Fatal("Unmarshal() returned ", e)
+	}
+	if errs[0].Error() != `properties: field Port ("db.port"): strconv.ParseUint: parsing "70000": value out of range` {
+		t.Error("errs[0] is ", errs[0])
+	}
+	var s struct {
+		List []string `prop:"list"`
+		Name string   `prop:"name"`
+	}
+	p.Set("name", "app")
+	if e := Unmarshal(p, &s); !errors.Is(e, ErrUnsupportedType) || s.Name != "app" {
+		t.Error("Unmarshal() returned ", e)
+	}
+	if e := Unmarshal(p, s); e == nil {
+		t.Error("Unmarshal() of a struct value returned no error")
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	c := config{"example.com", 5432, true, 0.1, 90 * time.Second, -3, "app", "skipped", "hidden"}
+	p, e := Marshal(&c)
+	if e != nil {
+		t.Fatal("Marshal() returned ", e)
+	}
+	want := "Retries=-3\ndb.host=example.com\ndb.port=5432\ndebug=true\nname=app\nratio=0.1\ntimeout=1m30s\n"
+	if p.String() != want {
+		t.Errorf("Marshal() returned %q", p.String())
+	}
+	var r config
+	if e := Unmarshal(p, &r); e != nil || r != (config{"example.com", 5432, true, 0.1, 90 * time.Second, -3, "app", "", ""}) {
+		t.Errorf("Unmarshal() returned %v, stored %+v", e, r)
+	}
+	if q, e := Marshal(c); e != nil || !q.Equal(p) {
+		t.Error("Marshal() of a struct value returned ", q, e)
+	}
+	var s struct {
+		Name string
+		Tags map[string]string `prop:"tags"`
+	}
+	if q, e := Marshal(s); q != nil || !errors.Is(e, ErrUnsupportedType) {
+		t.Error("Marshal() returned ", q, e)
+	}
+	if q, e := Marshal("text"); q != nil || e == nil {
+		t.Error(`Marshal("text") returned `, q, e)
+	}
+}
@@ -9,8 +9,16 @@ package properties
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"unicode/utf16"
 	"unicode/utf8"
 )
@@ -19,12 +27,17 @@ import (
 // the rune is out of range or if no escaping is needed, writes the escape
 // sequence of utf8.RuneError.
 // If the rune is greater than 0xffff, writes the '\uxxxx' sequences of the
-// two surrogates.
+// two surrogates. The hexadecimal digits are written in lower case, unless
+// mode holds the escapeUpperHex flag.
 // It returns the number of bytes written.
-func escapeRune(p []byte, r rune) int {
+func escapeRune(p []byte, r rune, mode EscapeMode) int {
 	if r > 0xffff {
 		r1, r2 := utf16.EncodeRune(r)
-		return escapeRune(p, r1) + escapeRune(p[6:], r2)
+		return escapeRune(p, r1, mode) + escapeRune(p[6:], r2, mode)
+	}
+	digit := byte('a')
+	if mode&escapeUpperHex != 0 {
+		digit = 'A'
 	}
 	if 0x20 <= r && r <= 0x7e {
 		return 0
@@ -37,7 +50,7 @@ func escapeRune(p []byte, r rune) int {
 	for i := 5; i >= 2; i-- {
 		b := byte(0x0f & r)
 		if b > 9 {
-			b += 'a' - 10
+			b += digit - 10
 		} else {
 			b += '0'
 		}
@@ -47,13 +60,24 @@ func escapeRune(p []byte, r rune) int {
 	return 6
 }
 
+// decodeMode selects the optional escape sequences recognized when loading.
+type decodeMode int
+
+const (
+	// decodeOctal recognizes the octal escape sequences, a '\' followed by
+	// one to three octal digits.
+	decodeOctal decodeMode = 1 << iota
+	// decodeBackspace recognizes the sequence '\b' as U+0008.
+	decodeBackspace
+)
+
 // unescapeRune parses the first escape sequence in p. It recognizes the
-// sequences '\t', '\n', '\f', '\r', '\uxxxx'. If a '\uxxxx' sequence holds
-// a surrogate, a second '\uxxxx' sequence must be present, holding the
-// next surrogate.
+// sequences '\t', '\n', '\f', '\r', '\uxxxx', and the optional sequences
+// selected by mode. If a '\uxxxx' sequence holds a surrogate, a second
+// '\uxxxx' sequence must be present, holding the next surrogate.
 // It returns the rune and number of bytes parsed. If p doesn't start with
 // an escape sequence, returns utf8.RuneError and 0.
-func unescapeRune(p []byte) (rune, int) {
+func unescapeRune(p []byte, mode decodeMode) (rune, int) {
 	n := len(p)
 	if n < 1 || p[0] != '\\' {
 		return utf8.RuneError, 0
@@ -71,6 +95,20 @@ func unescapeRune(p []byte) (rune, int) {
 	if r == 'r' {
 		return '\r', 2
 	}
+	if r == 'b' && mode&decodeBackspace != 0 {
+		return '\b', 2
+	}
+	if mode&decodeOctal != 0 && '0' <= r && r <= '7' {
+		r = 0
+		i := 1
+		for ; i < n && i < 4 && '0' <= p[i] && p[i] <= '7'; i++ {
+			r = (r << 3) | rune(p[i]-'0')
+		}
+		if !utf8.ValidRune(r) {
+			r = utf8.RuneError
+		}
+		return r, i
+	}
 	if r != 'u' {
 		return r, size + 1
 	}
@@ -95,10 +133,11 @@ func unescapeRune(p []byte) (rune, int) {
 	if n < 6 {
 		r = utf8.RuneError
 	}
-	// here, n = 6 (the length of a '\uxxxx' sequence)
-	if utf16.IsSurrogate(r) {
+	// here, n = 6 (the length of a '\uxxxx' sequence); a high surrogate must
+	// be followed by the sequence of a low one
+	if 0xd800 <= r && r < 0xdc00 {
 		q := r
-		r, size = unescapeRune(p[6:])
+		r, size = unescapeRune(p[6:], mode)
 		if size != 6 || !utf16.IsSurrogate(r) {
 			return utf8.RuneError, 6
 		}
@@ -120,24 +159,18 @@ func isCmtPrefix(r rune) bool {
 	return (r == '#' || r == '!')
 }
 
-func unescape(p []byte, split bool) (string, int) {
+// unescape returns the string encoded by p and the number of bytes parsed.
+// If split is true, it stops before the first unescaped space or delimiter.
+// The optional escape sequences selected by mode are recognized.
+func unescape(p []byte, split bool, mode decodeMode) (string, int) {
 	var b strings.Builder
 	n := 0
 	for len(p) > 0 {
-		r, size := unescapeRune(p)
+		r, size := unescapeRune(p, mode)
 		if size == 0 {
 			r, size = utf8.DecodeRune(p)
 			if split && (isSpace(r) || isDelimiter(r)) {
-				p = p[size:]
-				n += size
-				for len(p) > 0 {
-					r, size = utf8.DecodeRune(p)
-					if !(isSpace(r) || isDelimiter(r)) {
-						return b.String(), n
-					}
-					p = p[size:]
-					n += size
-				}
+				break
 			}
 		}
 		b.WriteRune(r)
@@ -147,18 +180,110 @@ func unescape(p []byte, split bool) (string, int) {
 	return b.String(), n
 }
 
-func loadBytes(r bufio.Reader) ([]byte, error) {
+// parseLine splits the full line p into the unescaped key and value. It also
+// returns the separator found between them: the first delimiter ('=' or
+// ':'), ' ' if they are separated by space only, or 0 if there's nothing
+// after the key. The optional escape sequences selected by mode are
+// recognized.
+func parseLine(p []byte, mode decodeMode) (string, string, byte) {
+	key, n := unescape(p, true, mode)
+	var sep byte
+	for ; n < len(p) && (isSpace(rune(p[n])) || isDelimiter(rune(p[n]))); n++ {
+		if isDelimiter(rune(p[n])) {
+			if sep == 0 || sep == ' ' {
+				sep = p[n]
+			}
+		} else if sep == 0 {
+			sep = ' '
+		}
+	}
+	value, _ := unescape(p[n:], false, mode)
+	return key, value, sep
+}
+
+// cutComment splits the full line p before its inline comment, started by
+// the first unescaped '#' or '!' following an unescaped space. It returns
+// the line without the comment and the space before it, the unescaped text
+// of the comment without its prefix and surrounding space, and whether a
+// comment was found. The optional escape sequences selected by mode are
+// recognized in the comment.
+func cutComment(p []byte, mode decodeMode) ([]byte, string, bool) {
+	end := 0
+	for i := 0; i < len(p); i++ {
+		c := rune(p[i])
+		if c == '\\' {
+			i += 1
+			end = i + 1
+			if end > len(p) {
+				end = len(p)
+			}
+			continue
+		}
+		if isCmtPrefix(c) && end < i {
+			text, _ := unescape(bytes.TrimSpace(p[i+1:]), false, mode)
+			return p[:end], text, true
+		}
+		if !isSpace(c) {
+			end = i + 1
+		}
+	}
+	return p, "", false
+}
+
+// lineReader reads the full lines of a properties input, counting the
+// partial lines read so far. If keepIndent is true, the space at the start
+// of the continuation lines is kept. If keepRaw is true, raw holds the bytes
+// read for the last full line, as they appear in the input.
+type lineReader struct {
+	r          *bufio.Reader
+	keepIndent bool
+	keepRaw    bool
+	raw        []byte
+	line       int
+}
+
+func (l *lineReader) readByte() (byte, error) {
+	x, e := l.r.ReadByte()
+	if e == nil && l.keepRaw {
+		l.raw = append(l.raw, x)
+	}
+	return x, e
+}
+
+func (l *lineReader) unreadByte() error {
+	e := l.r.UnreadByte()
+	if e == nil && l.keepRaw {
+		l.raw = l.raw[:len(l.raw)-1]
+	}
+	return e
+}
+
+// newLineReader returns a lineReader reading from r. A UTF-8 byte order mark
+// at the very start of r is skipped.
+func newLineReader(r io.Reader, keepIndent bool) *lineReader {
+	b := bufio.NewReader(r)
+	if bom, _ := b.Peek(3); bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		b.Discard(3)
+	}
+	return &lineReader{r: b, keepIndent: keepIndent}
+}
+
+// next reads a full line. It returns the line, the number (starting from 1)
+// of the partial line where it starts, and any error encountered.
+func (l *lineReader) next() ([]byte, int, error) {
 	var b []byte
+	l.raw = l.raw[:0]
+	line := l.line + 1
 	done := false
-	for !done {
-		x, e := r.ReadByte()
+	for first := true; !done; first = false {
+		x, e := l.readByte()
 		if e != nil {
-			return b, e
+			return b, line, e
 		}
-		for x == '\t' || x == '\f' || x == ' ' {
-			x, e = r.ReadByte()
+		for (first || !l.keepIndent) && (x == '\t' || x == '\f' || x == ' ') {
+			x, e = l.readByte()
 			if e != nil {
-				return b, e
+				return b, line, e
 			}
 		}
 		if (x == '#' || x == '!') && len(b) == 0 {
@@ -172,21 +297,22 @@ func loadBytes(r bufio.Reader) ([]byte, error) {
 				esc = false
 			}
 			b = append(b, x)
-			x, e = r.ReadByte()
+			x, e = l.readByte()
 			if e != nil {
-				return b, e
+				return b, line, e
 			}
 		}
+		l.line += 1
 		if x == '\r' {
-			x, e = r.ReadByte()
+			x, e = l.readByte()
 			if e != nil {
-				return b, e
+				return b, line, e
 			}
 		}
 		if x != '\n' {
-			e = r.UnreadByte()
+			e = l.unreadByte()
 			if e != nil {
-				return b, e
+				return b, line, e
 			}
 		}
 		if !done {
@@ -197,16 +323,65 @@ func loadBytes(r bufio.Reader) ([]byte, error) {
 			}
 		}
 	}
-	return b, nil
+	return b, line, nil
+}
+
+// ErrorList is a list of errors. It is returned by the methods checking
+// several properties at once, so that all the problems are reported together.
+type ErrorList []error
+
+// Error returns the messages of the errors in the list, one per line.
+func (l ErrorList) Error() string {
+	s := make([]string, len(l))
+	for i, e := range l {
+		s[i] = e.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Unwrap returns the errors in the list.
+func (l ErrorList) Unwrap() []error {
+	return l
+}
+
+// sortedKeys returns the keys of data in lexicographic order.
+func sortedKeys(data map[string]string) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Entry holds a key-value pair of a property table.
+type Entry struct {
+	Key   string
+	Value string
 }
 
 // Table represents a property table. It contains a hash of key-value pairs.
 // It also contains a secondary property table as its "defaults". The
 // secondary table is searched if the property key was not found in the
 // primary table.
+// A Table isn't safe for concurrent use: it may be read by several
+// goroutines at once, but not while it's modified. SyncTable and
+// AtomicTable are the variants safe for concurrent use.
 type Table struct {
-	data     map[string]string
-	defaults *Table
+	data        map[string]string
+	defaults    *Table
+	fallbacks   map[string]string
+	separators  map[byte]int
+	lines       map[string]int
+	inline      map[string]string
+	comments    map[string]string
+	seq         map[string]int
+	next        int
+	doc         []docLine
+	validator   func(string) error
+	trueValues  []string
+	falseValues []string
+	dirty       bool
 }
 
 // Load reads a property table (key and value pairs) from the reader in a
@@ -219,7 +394,8 @@ type Table struct {
 // adjacent partial lines by escaping the line terminators with the backslash
 // character '\'. Comment lines can't spread. A partial line holding a
 // comment must have its own comment prefix.
-// Lines are read from the input until the end-of-file is reached.
+// Lines are read from the input until the end-of-file is reached. A UTF-8
+// byte order mark (U+FEFF) at the very start of the input is skipped.
 // A partial line containing only white space characters is considered empty
 // and is ignored. A comment line has an ASCII '#' or '!' as its first
 // non-space character. Comment lines are ignored and do not encode key-value
@@ -268,9 +444,10 @@ type Table struct {
 // the final result; the '\', the line terminator, and the leading spaces
 // on the continuation line are discarded and not replaced by other
 // characters.
-// Octal escapes are not recognized. The character sequence '\b' does not
-// represent a backspace character. A backslash character before a non-valid
-// escape character is not an error, the backslash is silently dropped.
+// Octal escapes are not recognized (see LoadOptions.Octal). The character
+// sequence '\b' does not represent a backspace character (see
+// LoadOptions.Backspace). A backslash character before a non-valid escape
+// character is not an error, the backslash is silently dropped.
 // Escapes are not necessary for single and double quotes, however, by the
 // rule above, single and double quote characters preceded by a backslash
 // yield single and double quote characters, respectively. Only a single 'u'
@@ -279,16 +456,207 @@ type Table struct {
 // surrogates.
 // Returns the number of key-value pairs loaded and any error encountered.
 func (p *Table) Load(r io.Reader) (int, error) {
-	var reader = bufio.NewReader(r)
+	return p.LoadWith(r, LoadOptions{})
+}
+
+// LoadOptions holds the options used by LoadWith. The zero value loads the
+// input the same way as Load.
+type LoadOptions struct {
+	// Decoder, if not nil, is applied to the input before parsing. It
+	// receives the input and returns a reader producing UTF-8 text, which
+	// allows loading files stored in legacy encodings such as Latin-1. The
+	// readers returned by transform.NewReader (golang.org/x/text/transform)
+	// for a decoder from golang.org/x/text/encoding fit this purpose.
+	Decoder func(io.Reader) io.Reader
+	// KeepContinuationIndent keeps the space characters at the start of
+	// the continuation lines as part of the key or value, instead of
+	// discarding them.
+	KeepContinuationIndent bool
+	// Strict reports the input likely to be malformed. A key defined more
+	// than once is reported, at each definition after the first, as a
+	// *LineError wrapping ErrDuplicateKey. Distinct keys that become equal
+	// once their leading and trailing white space is trimmed, like "host"
+	// and "host\ ", are reported as errors wrapping ErrKeyCollision. All the
+	// key-value pairs are still loaded, the last definition of a key
+	// winning, and all the problems are returned together in an ErrorList.
+	Strict bool
+	// Lines records, for each key loaded, the number of the line where it's
+	// defined, as returned by Line.
+	Lines bool
+	// InlineComments reads an unescaped '#' or '!' following a space, as in
+	// "port=8080 # default", as the start of a comment ending the line,
+	// instead of a part of the value. The comment is recorded as the
+	// inline comment of the key, as returned by InlineComment, and the
+	// space before it is dropped. A key loaded without a comment loses the
+	// inline comment it had.
+	InlineComments bool
+	// Document records the lines of the input, with its comments and blank
+	// lines, so that Store, StoreWith and Save write the table back in the
+	// same layout. The entries whose values (and inline comments) are
+	// unchanged are written as they were read, the changed entries are
+	// rewritten in place, the entries of the deleted keys are dropped, and
+	// the keys added since are written at the end. If a key is defined
+	// several times, only its last definition is rewritten, and all of
+	// them are dropped when the key is deleted. Loading more input with
+	// this option appends to the recorded lines; Clear forgets them. The
+	// line terminators of the recorded lines are replaced by the line
+	// separator. As the comments of the document are kept, the header, the
+	// footer and the timestamp of StoreWith and the comments of Save aren't
+	// written, so that they don't pile up across the load and store cycles.
+	// The BlankBetween store option has no effect on a document.
+	Document bool
+	// Octal decodes the octal escape sequences, a '\' followed by one to
+	// three octal digits (as many as present), into the rune of that code:
+	// "\0" is U+0000 and "\101" is 'A'. As the sequence ends after three
+	// digits, "\1234" is 'S' followed by '4'. Without this option, Load
+	// drops the backslash and keeps the digits.
+	Octal bool
+	// Backspace decodes the escape sequence "\b" into U+0008. Without this
+	// option, Load drops the backslash and keeps the 'b'.
+	Backspace bool
+	// ValidateKeys checks each key loaded with the validator set by
+	// SetKeyValidator, if any. The rejected keys aren't loaded nor counted;
+	// each of them is reported as a *LineError wrapping the error of the
+	// validator, and all of them are returned together in an ErrorList
+	// once the input is read. With the Document option, the lines of the
+	// rejected keys are recorded and written back as they were read.
+	ValidateKeys bool
+}
+
+// ErrKeyCollision is reported by a strict load when two distinct keys are
+// equal once trimmed of white space.
+var ErrKeyCollision = errors.New("keys collide after trimming")
+
+// ErrDuplicateKey is reported by a strict load when a key is defined more
+// than once.
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// LineError records a problem found by a load at a given line of the input.
+// Line is the number, starting from 1, of the line where the definition of
+// Key starts.
+type LineError struct {
+	Line int
+	Key  string
+	Err  error
+}
+
+// Error returns the line number, the key and the problem found.
+func (e *LineError) Error() string {
+	return fmt.Sprintf("properties: line %d: %q: %v", e.Line, e.Key, e.Err)
+}
+
+// Unwrap returns the problem found.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// LoadWith reads a property table from r in the format described for Load,
+// using the given options.
+// Returns the number of key-value pairs loaded and any error encountered.
+func (p *Table) LoadWith(r io.Reader, opts LoadOptions) (int, error) {
+	return p.load(context.Background(), r, opts)
+}
+
+// LoadContext reads a property table from r like Load, checking ctx before
+// each line. If ctx is done, it stops reading and returns the number of
+// key-value pairs loaded so far and the error of ctx. The pairs loaded before
+// the cancellation are left in the table. A read blocked in r isn't
+// interrupted: the cancellation is seen once it returns.
+func (p *Table) LoadContext(ctx context.Context, r io.Reader) (int, error) {
+	return p.load(ctx, r, LoadOptions{})
+}
+
+// load reads a property table from r using the given options, checking ctx
+// before each line.
+func (p *Table) load(ctx context.Context, r io.Reader, opts LoadOptions) (int, error) {
+	if opts.Decoder != nil {
+		r = opts.Decoder(r)
+	}
+	reader := newLineReader(r, opts.KeepContinuationIndent)
+	var entries map[string]int
+	if opts.Document {
+		reader.keepRaw = true
+		entries = p.docEntries()
+	}
+	var mode decodeMode
+	if opts.Octal {
+		mode |= decodeOctal
+	}
+	if opts.Backspace {
+		mode |= decodeBackspace
+	}
+	var trimmed map[string]string
+	var defined map[string]bool
+	var errs ErrorList
 	count := 0
 	done := false
 	for !done {
-		b, e := loadBytes(*reader)
+		if e := ctx.Err(); e != nil {
+			return count, e
+		}
+		b, line, e := reader.next()
 		if len(b) > 0 && b[0] != '#' && b[0] != '!' {
-			key, i := unescape(b, true)
-			value, _ := unescape(b[i:], false)
-			p.data[key] = value
-			count += 1
+			var comment string
+			var commented bool
+			if opts.InlineComments {
+				b, comment, commented = cutComment(b, mode)
+			}
+			key, value, sep := parseLine(b, mode)
+			if isDelimiter(rune(sep)) {
+				if p.separators == nil {
+					p.separators = make(map[byte]int)
+				}
+				p.separators[sep] += 1
+			}
+			var invalid error
+			if opts.ValidateKeys && p.validator != nil {
+				invalid = p.validator(key)
+			}
+			if invalid != nil {
+				errs = append(errs, &LineError{line, key, invalid})
+				if opts.Document {
+					p.addDocLine(docLine{raw: string(trimEOL(reader.raw))}, entries)
+				}
+			} else {
+				if opts.Strict {
+					if trimmed == nil {
+						trimmed = make(map[string]string)
+						defined = make(map[string]bool)
+					}
+					t := strings.TrimSpace(key)
+					if first, found := trimmed[t]; defined[key] {
+						errs = append(errs, &LineError{line, key, ErrDuplicateKey})
+					} else if !found {
+						trimmed[t] = key
+					} else {
+						errs = append(errs, fmt.Errorf("properties: %q and %q: %w", first, key, ErrKeyCollision))
+					}
+					defined[key] = true
+				}
+				p.Set(key, value)
+				if opts.InlineComments {
+					p.setInlineComment(key, comment, commented)
+				}
+				if opts.Lines {
+					if p.lines == nil {
+						p.lines = make(map[string]int)
+					}
+					p.lines[key] = line
+				}
+				if opts.Document {
+					p.addDocLine(docLine{
+						raw:       string(trimEOL(reader.raw)),
+						key:       key,
+						value:     value,
+						comment:   comment,
+						commented: commented,
+						entry:     true,
+					}, entries)
+				}
+				count += 1
+			}
+		} else if opts.Document && (e == nil || len(reader.raw) > 0) {
+			p.addDocLine(docLine{raw: string(trimEOL(reader.raw))}, entries)
 		}
 		if e != nil {
 			if e != io.EOF {
@@ -297,6 +665,9 @@ func (p *Table) Load(r io.Reader) (int, error) {
 			done = true
 		}
 	}
+	if len(errs) > 0 {
+		return count, errs
+	}
 	return count, nil
 }
 
@@ -307,14 +678,91 @@ func (p *Table) LoadString(s string) (int, error) {
 	return p.Load(r)
 }
 
-func escape(key, value string, ascii bool) []byte {
+// EscapeMode selects the runes written as '\uxxxx' escape sequences.
+type EscapeMode int
+
+const (
+	// EscapeNone writes every rune as UTF-8.
+	EscapeNone EscapeMode = iota
+	// EscapeASCII escapes any rune lesser than 0x20 or greater than 0x7e.
+	EscapeASCII
+	// EscapeLatin1 escapes any rune lesser than 0x20 or greater than 0x7e,
+	// except the printable Latin-1 runes, from 0xa0 to 0xff, which are
+	// written as single ISO-8859-1 bytes, for files edited as ISO-8859-1.
+	// Such files are read back by LoadWith with a Latin-1 Decoder.
+	EscapeLatin1
+)
+
+// The flags below are added to an EscapeMode by StoreWith, according to the
+// store options.
+const (
+	// escapeBackspace writes U+0008 in the keys and values as '\b'.
+	escapeBackspace EscapeMode = 1 << (iota + 8)
+	// escapeUpperHex writes the hexadecimal digits of the '\uxxxx' sequences
+	// in upper case.
+	escapeUpperHex
+	escapeFlags = escapeBackspace | escapeUpperHex
+)
+
+// escapeMode returns the escape mode selected by the ascii parameter of the
+// functions predating EscapeMode.
+func escapeMode(ascii bool) EscapeMode {
+	if ascii {
+		return EscapeASCII
+	}
+	return EscapeNone
+}
+
+// escapes reports whether r is written as an escape sequence in mode m.
+func (m EscapeMode) escapes(r rune) bool {
+	switch m &^ escapeFlags {
+	case EscapeASCII:
+		return r < 0x20 || r > 0x7e
+	case EscapeLatin1:
+		return r < 0x20 || (r > 0x7e && r < 0xa0) || r > 0xff
+	}
+	return false
+}
+
+// encodeRune writes r into p, as a single byte if r is a printable Latin-1
+// rune and m is EscapeLatin1, as UTF-8 otherwise. It returns the number of
+// bytes written.
+func (m EscapeMode) encodeRune(p []byte, r rune) int {
+	if m&^escapeFlags == EscapeLatin1 && 0xa0 <= r && r <= 0xff {
+		p[0] = byte(r)
+		return 1
+	}
+	return utf8.EncodeRune(p, r)
+}
+
+func escape(key, value string, mode EscapeMode) []byte {
+	return escapeEntry(key, "=", value, mode)
+}
+
+// escapeEntry returns the line holding key and value, escaped as described
+// for Store, separated by delim, which is written unchanged. A delim made of
+// space characters only is replaced by "=" for the empty key, as the line
+// would be read back with the value as the key.
+func escapeEntry(key, delim, value string, mode EscapeMode) []byte {
 	var b bytes.Buffer
+	if key == "" && strings.Trim(delim, " \t\f") == "" {
+		delim = "="
+	}
+	escapeString(&b, key, mode, true)
+	b.WriteString(delim)
+	escapeString(&b, value, mode, false)
+	return b.Bytes()
+}
+
+// escapeString writes s to b, escaped in the given mode. Every '\' is
+// doubled. If key is true, every space and delimiter is preceded by a '\',
+// otherwise only the leading one is.
+func escapeString(b *bytes.Buffer, s string, mode EscapeMode, key bool) {
 	var buffer [12]byte
-	var r rune
-	for _, r = range key {
+	for i, r := range s {
 		size := 0
-		if ascii {
-			size = escapeRune(buffer[:], r)
+		if mode.escapes(r) && !(r == '\b' && mode&escapeBackspace != 0) {
+			size = escapeRune(buffer[:], r, mode)
 		}
 		if size == 0 {
 			if r == '\n' {
@@ -325,49 +773,149 @@ func escape(key, value string, ascii bool) []byte {
 				b.WriteString("\\r")
 				continue
 			}
-			if isSpace(r) || isDelimiter(r) || isCmtPrefix(r) {
-				b.WriteByte('\\')
+			if r == '\f' {
+				b.WriteString("\\f")
+				continue
 			}
-			size = utf8.EncodeRune(buffer[:], r)
-		}
-		b.Write(buffer[:size])
-	}
-	b.WriteRune('=')
-	r, _ = utf8.DecodeRuneInString(value)
-	if isSpace(r) || isDelimiter(r) {
-		b.WriteByte('\\')
-	}
-	for _, r = range value {
-		size := 0
-		if ascii {
-			size = escapeRune(buffer[:], r)
-		}
-		if size == 0 {
-			if r == '\n' {
-				b.WriteString("\\n")
+			if r == '\\' {
+				b.WriteString("\\\\")
 				continue
 			}
-			if r == '\r' {
-				b.WriteString("\\r")
+			if r == '\b' && mode&escapeBackspace != 0 {
+				b.WriteString("\\b")
 				continue
 			}
-			if isCmtPrefix(r) {
+			if isCmtPrefix(r) || ((key || i == 0) && (isSpace(r) || isDelimiter(r))) {
 				b.WriteByte('\\')
 			}
-			size = utf8.EncodeRune(buffer[:], r)
+			size = mode.encodeRune(buffer[:], r)
 		}
 		b.Write(buffer[:size])
 	}
+}
+
+// Filter copies the properties read from r to w, streaming them one at a time
+// without building a table. Each key-value pair read is passed through f,
+// which returns the key and the value to be written, and whether the entry is
+// written at all. If f is nil, the entries are copied unchanged. The input is
+// read as described for Load and the output is written as described for
+// Store. The comment and blank lines of the input are dropped.
+// The function returns the number of key-value pairs written and any error
+// encountered.
+func Filter(r io.Reader, w io.Writer, f func(key, value string) (string, string, bool), ascii bool) (int, error) {
+	reader := newLineReader(r, false)
+	eol := []byte("\n")
+	count := 0
+	for {
+		b, _, e := reader.next()
+		if len(b) > 0 && !isCmtPrefix(rune(b[0])) {
+			key, value, _ := parseLine(b, 0)
+			keep := true
+			if f != nil {
+				key, value, keep = f(key, value)
+			}
+			if keep {
+				if _, e := w.Write(escape(key, value, escapeMode(ascii))); e != nil {
+					return count, e
+				}
+				if _, e := w.Write(eol); e != nil {
+					return count, e
+				}
+				count += 1
+			}
+		}
+		if e == io.EOF {
+			return count, nil
+		}
+		if e != nil {
+			return count, e
+		}
+	}
+}
+
+// ErrSyntax is reported by ParseEntry and LoadEnv when a line doesn't hold a
+// key-value pair.
+var ErrSyntax = errors.New("not a key-value pair")
+
+// ParseEntry splits line into the key and the value it holds, unescaped, as
+// done by Load. The line may spread across several partial lines by escaping
+// the line terminators, but it must hold a single key-value pair. It returns
+// an error wrapping ErrSyntax if the line is blank, if it's a comment, if the
+// key isn't followed by a delimiter ('=', ':' or space), or if any line that
+// isn't blank follows it.
+func ParseEntry(line string) (string, string, error) {
+	reader := newLineReader(strings.NewReader(line), false)
+	b, _, e := reader.next()
+	for e == nil {
+		var rest []byte
+		rest, _, e = reader.next()
+		if len(rest) > 0 {
+			return "", "", fmt.Errorf("properties: %q: %w", line, ErrSyntax)
+		}
+	}
+	if e != nil && e != io.EOF {
+		return "", "", e
+	}
+	if len(b) == 0 || isCmtPrefix(rune(b[0])) {
+		return "", "", fmt.Errorf("properties: %q: %w", line, ErrSyntax)
+	}
+	key, value, sep := parseLine(b, 0)
+	if sep == 0 {
+		return "", "", fmt.Errorf("properties: %q: %w", line, ErrSyntax)
+	}
+	return key, value, nil
+}
+
+// escapeCommented returns the line holding key and value, escaped as by
+// escapeEntry, followed by the inline comment text. The trailing space of the
+// value is escaped, so that it isn't dropped with the space before the
+// comment when the line is loaded back.
+func escapeCommented(key, delim, value, text string, mode EscapeMode) []byte {
+	trimmed := strings.TrimRight(value, " \t")
+	b := bytes.NewBuffer(escapeEntry(key, delim, trimmed, mode))
+	var buffer [12]byte
+	for _, r := range value[len(trimmed):] {
+		if mode.escapes(r) {
+			b.Write(buffer[:escapeRune(buffer[:], r, mode)])
+		} else {
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		}
+	}
+	b.WriteString(" # ")
+	for _, r := range text {
+		if r == '\\' {
+			b.WriteString("\\\\")
+		} else if mode.escapes(r) {
+			b.Write(buffer[:escapeRune(buffer[:], r, mode)])
+		} else {
+			b.Write(buffer[:mode.encodeRune(buffer[:], r)])
+		}
+	}
 	return b.Bytes()
 }
 
-func escapeText(text string, ascii bool) []byte {
+// FormatEntry returns the line holding key and value, escaped exactly as
+// written by Store, without the trailing line terminator. The ascii
+// parameter has the same meaning as for Store.
+func FormatEntry(key, value string, ascii bool) string {
+	return string(escape(key, value, escapeMode(ascii)))
+}
+
+// escapeText returns text formatted as a comment block, as described for
+// Save. If eol isn't empty, every line terminator ("\r\n", "\r" or "\n") in
+// text is replaced by eol, otherwise the line terminators are kept.
+func escapeText(text string, mode EscapeMode, eol string) []byte {
 	var b bytes.Buffer
 	var buffer [12]byte
 	last := rune('\n')
 	for _, r := range text {
 		if r == '\n' || r == '\r' {
-			b.WriteRune(r)
+			if eol == "" {
+				b.WriteRune(r)
+			} else if r == '\r' || last != '\r' {
+				b.WriteString(eol)
+			}
 			last = r
 			continue
 		}
@@ -375,11 +923,11 @@ func escapeText(text string, ascii bool) []byte {
 			b.WriteByte('#')
 		}
 		size := 0
-		if ascii {
-			size = escapeRune(buffer[:], r)
+		if mode.escapes(r) {
+			size = escapeRune(buffer[:], r, mode)
 		}
 		if size == 0 {
-			size = utf8.EncodeRune(buffer[:], r)
+			size = mode.encodeRune(buffer[:], r)
 		}
 		b.Write(buffer[:size])
 		last = r
@@ -392,20 +940,83 @@ func escapeText(text string, ascii bool) []byte {
 // (if any) are not written out by this method.
 // If ascii is true, then any rune lesser than 0x20 or greater than 0x7e is
 // converted to its '\uxxxx'  escape sequence(s).
-// Every key-value pair in the table is written out, one per line. For each
-// entry, the key is written, then an ASCII '=', then the associated value.
+// Every key-value pair in the table is written out, one per line, in the
+// lexicographic order of the keys, so that the output is the same for equal
+// tables, or in insertion order if the table is in the ordered mode (see
+// SetOrdered). For each entry, the key is written, then an ASCII '=', then
+// the associated value.
 // For the key, all space characters are written with a preceding '\'
 // character. For the value, leading space characters, but not embedded or
 // trailing space characters, are written with a preceding '\' character.
 // The key and value characters '#', '!', '=', and ':' are written with a
-// preceding '\' to ensure that they are properly loaded.
+// preceding '\' to ensure that they are properly loaded, and the '\'
+// characters are written as '\\'.
+// An empty key is written as nothing, so that its line starts with '=' and
+// is loaded back as the empty key.
 // The function returns the number of key-value pairs written and any error
 // encountered.
 func (p *Table) Store(w io.Writer, ascii bool) (int, error) {
+	count, e := p.store(w, nil, StoreOptions{Escape: escapeMode(ascii)})
+	if e == nil {
+		p.dirty = false
+	}
+	return count, e
+}
+
+// StoreTransform writes this property table to w like Store, but passes
+// each key-value pair through f before writing it. The function f returns
+// the key and the value to be written, and whether the entry is written at
+// all, so that it can rename, rewrite, or drop the entries without building
+// an intermediate table. The table itself is not modified. If f is nil, the
+// entries are written unchanged.
+// The function returns the number of key-value pairs written and any error
+// encountered.
+func (p *Table) StoreTransform(w io.Writer, f func(key, value string) (string, string, bool), ascii bool) (int, error) {
+	return p.store(w, f, StoreOptions{Escape: escapeMode(ascii)})
+}
+
+// store writes the entries of the primary table to w, passing them through
+// f if not nil, using the given options. The header and the footer are not
+// written. If f is nil and the table holds a recorded document, the document
+// is written by storeDocument instead.
+func (p *Table) store(w io.Writer, f func(key, value string) (string, string, bool), opts StoreOptions) (int, error) {
 	count := 0
 	eol := []byte("\n")
-	for key, value := range p.data {
-		if _, e := w.Write(escape(key, value, ascii)); e != nil {
+	if opts.LineSeparator != "" {
+		eol = []byte(opts.LineSeparator)
+	}
+	if p.doc != nil && f == nil {
+		return p.storeDocument(w, opts)
+	}
+	delim := opts.Delimiter
+	if delim == "" {
+		delim = "="
+	}
+	for _, key := range p.keys() {
+		value := p.data[key]
+		comment, commented := p.inline[key]
+		above, found := p.comments[key]
+		if f != nil {
+			var keep bool
+			if key, value, keep = f(key, value); !keep {
+				continue
+			}
+		}
+		if opts.BlankBetween && count > 0 {
+			if _, e := w.Write(eol); e != nil {
+				return count, e
+			}
+		}
+		if found {
+			if e := writeComment(w, above, opts.Escape, string(eol)); e != nil {
+				return count, e
+			}
+		}
+		b := escapeEntry(key, delim, value, opts.Escape)
+		if commented {
+			b = escapeCommented(key, delim, value, comment, opts.Escape)
+		}
+		if _, e := w.Write(b); e != nil {
 			return count, e
 		}
 		if _, e := w.Write(eol); e != nil {
@@ -416,6 +1027,169 @@ func (p *Table) Store(w io.Writer, ascii bool) (int, error) {
 	return count, nil
 }
 
+// StoreSubset writes to w, like Store, the key-value pairs of the primary
+// table whose keys start with prefix. The prefix is removed from the written
+// keys, so that the output can be loaded as a standalone table. The pairs in
+// the defaults table (if any) are not written out.
+// The function returns the number of key-value pairs written and any error
+// encountered.
+func (p *Table) StoreSubset(w io.Writer, prefix string, ascii bool) (int, error) {
+	return p.StoreTransform(w, func(key, value string) (string, string, bool) {
+		if !strings.HasPrefix(key, prefix) {
+			return key, value, false
+		}
+		return key[len(prefix):], value, true
+	}, ascii)
+}
+
+// DominantSeparator returns the delimiter, '=' or ':', used by most of the
+// key-value pairs loaded into the table so far, so that the style of a loaded
+// file can be preserved when it's written back. It returns '=' if the two
+// delimiters are used equally or if no delimiter has been loaded.
+func (p *Table) DominantSeparator() byte {
+	if p.separators[':'] > p.separators['='] {
+		return ':'
+	}
+	return '='
+}
+
+// StoreOptions holds the options used by StoreWith. The zero value writes
+// the table the same way as Store with ascii set to false.
+type StoreOptions struct {
+	// Escape selects the runes written as escape sequences. EscapeNone
+	// and EscapeASCII match the ascii parameter of Store set to false and
+	// true.
+	Escape EscapeMode
+	// Header, if not empty, is written before the entries as a comment,
+	// formatted like the comments of Save.
+	Header string
+	// Footer, if not empty, is written after the entries as a comment,
+	// formatted like the comments of Save.
+	Footer string
+	// BlankBetween, if true, separates the entries by blank lines.
+	BlankBetween bool
+	// Delimiter, if not empty, is written between the keys and the values
+	// instead of "=". It must be "=" or ":", possibly surrounded by space
+	// characters, as in " = ", or be made of space characters only. The
+	// delimiters and the space characters in the keys are escaped, so that
+	// any valid delimiter is read back by Load. A delimiter made of space
+	// characters only is replaced by "=" for the empty key.
+	Delimiter string
+	// LineSeparator, if not empty, is written at the end of the lines
+	// instead of "\n". It must be "\n", "\r\n" or "\r". The line
+	// terminators in the header and the footer are replaced by it too. The
+	// line terminators in the keys and the values are always escaped as
+	// "\n" and "\r", so they can't break the lines.
+	LineSeparator string
+	// Backspace writes U+0008 in the keys and values as "\b", as read back
+	// by LoadWith with the Backspace option set. It takes precedence over
+	// Escape: the rune is written as "\b" instead of "\u0008" with
+	// EscapeASCII or EscapeLatin1, and instead of the raw rune with
+	// EscapeNone.
+	Backspace bool
+	// UpperHex writes the hexadecimal digits of the '\uxxxx' sequences in
+	// upper case, as in "\u20AC", instead of lower case. Load reads both.
+	UpperHex bool
+	// Timestamp writes the current date and time, formatted as described
+	// by time.RFC1123, as a comment line after the header (if any) and
+	// before the entries, as done by the store method of the Java
+	// Properties class.
+	Timestamp bool
+	// Now, if not nil, returns the time written by the Timestamp option,
+	// instead of time.Now.
+	Now func() time.Time
+}
+
+// escapeMode returns the Escape option with the flags selected by the other
+// options.
+func (opts StoreOptions) escapeMode() EscapeMode {
+	mode := opts.Escape
+	if opts.Backspace {
+		mode |= escapeBackspace
+	}
+	if opts.UpperHex {
+		mode |= escapeUpperHex
+	}
+	return mode
+}
+
+// ErrLineSeparator is reported by StoreWith when the LineSeparator option
+// isn't a line terminator.
+var ErrLineSeparator = errors.New("invalid line separator")
+
+// ErrDelimiter is reported by StoreWith when the Delimiter option isn't a
+// delimiter that Load can read.
+var ErrDelimiter = errors.New("invalid delimiter")
+
+// validDelimiter reports whether d, surrounded by a key and a value, is read
+// as their delimiter by Load.
+func validDelimiter(d string) bool {
+	t := strings.Trim(d, " \t\f")
+	return t == "=" || t == ":" || (t == "" && d != "")
+}
+
+// writeComment writes text to w as a comment block, formatted as described
+// for Save, followed by a line separator. If eol isn't empty, it's used as
+// the line separator, also replacing the line terminators of text.
+func writeComment(w io.Writer, text string, mode EscapeMode, eol string) error {
+	if _, e := w.Write(escapeText(text, mode, eol)); e != nil {
+		return e
+	}
+	if eol == "" {
+		eol = "\n"
+	}
+	_, e := w.Write([]byte(eol))
+	return e
+}
+
+// StoreWith writes this property table to w like Store, using the given
+// options. The header and the footer comments, if any, are written before
+// and after the entries, and the timestamp, if requested, after the header,
+// unless the table holds a document recorded by LoadWith.
+// If the Delimiter or the LineSeparator option isn't valid, nothing is
+// written and the error wraps ErrDelimiter or ErrLineSeparator.
+// The function returns the number of key-value pairs written and any error
+// encountered.
+func (p *Table) StoreWith(w io.Writer, opts StoreOptions) (int, error) {
+	if opts.Delimiter != "" && !validDelimiter(opts.Delimiter) {
+		return 0, fmt.Errorf("properties: %q: %w", opts.Delimiter, ErrDelimiter)
+	}
+	switch opts.LineSeparator {
+	case "", "\n", "\r\n", "\r":
+	default:
+		return 0, fmt.Errorf("properties: %q: %w", opts.LineSeparator, ErrLineSeparator)
+	}
+	opts.Escape = opts.escapeMode()
+	if p.doc != nil {
+		opts.Header, opts.Footer, opts.Timestamp = "", "", false
+	}
+	if opts.Header != "" {
+		if e := writeComment(w, opts.Header, opts.Escape, opts.LineSeparator); e != nil {
+			return 0, e
+		}
+	}
+	if opts.Timestamp {
+		now := time.Now
+		if opts.Now != nil {
+			now = opts.Now
+		}
+		if e := writeComment(w, "#"+now().Format(time.RFC1123), opts.Escape, opts.LineSeparator); e != nil {
+			return 0, e
+		}
+	}
+	count, e := p.store(w, nil, opts)
+	if e != nil {
+		return count, e
+	}
+	if opts.Footer != "" {
+		if e := writeComment(w, opts.Footer, opts.Escape, opts.LineSeparator); e != nil {
+			return count, e
+		}
+	}
+	p.dirty = false
+	return count, nil
+}
+
 // Save writes this property table (key and element pairs) to w in a format
 // suitable for using the Load method. The properties in the defaults table
 // (if any) are not written out by this method.
@@ -425,23 +1199,27 @@ func (p *Table) Store(w io.Writer, ascii bool) (int, error) {
 // string, and a line separator are first written to w. Any set of line
 // terminators is replaced by a line separator and if the next character
 // in comments is not '#' or '!', then an ASCII '#' is written out after that
-// line separator.
-// Then every entry in the table is written out, one per line. For each
-// entry, the key is written, then an ASCII '=', then the associated value.
+// line separator. If comments is empty or holds only white space, or if the
+// table holds a document recorded by LoadWith, nothing is written before the
+// entries. Unlike the store method of the Java Properties class, Save doesn't
+// write the current date; StoreWith does with the Timestamp option.
+// Then every entry in the table is written out, one per line, in the
+// lexicographic order of the keys, or in insertion order if the table is in
+// the ordered mode (see SetOrdered). For each entry, the key is written, then
+// an ASCII '=', then the associated value.
 // For the key, all space characters are written with a preceding '\'
 // character. For the value, leading space characters, but not embedded or
 // trailing space characters, are written with a preceding '\' character.
 // The key and value characters '#', '!', '=', and ':' are written with a
-// preceding '\' to ensure that they are properly loaded.
+// preceding '\' to ensure that they are properly loaded, and the '\'
+// characters are written as '\\'.
 // The function returns the number of key-value pairs written and any error
 // encountered.
 func (p *Table) Save(w io.Writer, comments string, ascii bool) (int, error) {
-	eol := []byte("\n")
-	if _, e := w.Write(escapeText(comments, ascii)); e != nil {
-		return 0, e
-	}
-	if _, e := w.Write(eol); e != nil {
-		return 0, e
+	if strings.TrimSpace(comments) != "" && p.doc == nil {
+		if e := writeComment(w, comments, escapeMode(ascii), ""); e != nil {
+			return 0, e
+		}
 	}
 	return p.Store(w, ascii)
 }
@@ -456,24 +1234,76 @@ func (p *Table) SaveString(comments string, ascii bool) (string, error) {
 }
 
 // String returns a text representation (as UTF-8) of the property table (not
-// including the key-value pairs of the secondary table). The text can be
-// then reused by LoadString.
+// including the key-value pairs of the secondary table), in the order used
+// by Store. The text can be then reused by LoadString.
 func (p *Table) String() string {
 	var b strings.Builder
 	eol := []byte("\n")
-	for key, value := range p.data {
-		b.Write(escape(key, value, false))
+	for _, key := range p.keys() {
+		b.Write(escape(key, p.data[key], EscapeNone))
 		b.Write(eol)
 	}
 	return b.String()
 }
 
+// Canonical returns the entries of the primary table in a fixed text form,
+// so that equal tables always give the same bytes, for instance to compute
+// or to verify a signature of the table. The defaults table, the comments
+// and the options of Store are ignored. The form is the following:
+// every entry is written on its own line, ended by a single '\n'; the lines
+// are sorted by key, comparing the UTF-8 bytes of the keys; each line holds
+// the key, an ASCII '=' and the value, escaped as by Store with ascii set to
+// true. Every rune lesser than 0x20 or greater than 0x7e is written as a
+// '\uxxxx' sequence with lowercase hexadecimal digits, a rune greater than
+// 0xffff being written as the sequences of its two UTF-16 surrogates. The
+// runes '#', '!', '=', ':' and the space of the key, the leading space, '='
+// and ':' of the value, and every '#' and '!' of the value are preceded by a
+// '\', and every '\' of the key and of the value is written as '\\', so that
+// distinct tables never give the same bytes. Nothing else is written, an
+// empty table giving no bytes.
+func (p *Table) Canonical() []byte {
+	var b bytes.Buffer
+	for _, key := range sortedKeys(p.data) {
+		b.Write(escape(key, p.data[key], EscapeASCII))
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// ErrNotCanonical is reported by LoadCanonical when its input isn't in the
+// form returned by Canonical.
+var ErrNotCanonical = errors.New("not in canonical form")
+
+// LoadCanonical returns a new table holding the entries of b, which must be
+// exactly in the form returned by Canonical. The input is strict: any
+// deviation from the canonical form, like entries out of order, duplicate
+// keys, a different separator or escaping, comments, blank lines or a
+// missing final line terminator, is rejected even if the entries could be
+// loaded by Load. The error wraps ErrNotCanonical and names the number,
+// starting from 1, of the first line that differs from the canonical form.
+func LoadCanonical(b []byte) (*Table, error) {
+	p := NewTable()
+	if _, e := p.LoadWith(bytes.NewReader(b), LoadOptions{}); e != nil {
+		return nil, e
+	}
+	c := p.Canonical()
+	if !bytes.Equal(b, c) {
+		n := 0
+		for n < len(b) && n < len(c) && b[n] == c[n] {
+			n += 1
+		}
+		line := bytes.Count(b[:n], []byte("\n")) + 1
+		return nil, fmt.Errorf("properties: line %d: %w", line, ErrNotCanonical)
+	}
+	return p, nil
+}
+
 // NewTableWith creates and initializes a new property table using defaults
 // for the secondary table.
 func NewTableWith(defaults *Table) *Table {
 	return &Table{
-		map[string]string{},
-		defaults,
+		data:     map[string]string{},
+		defaults: defaults,
 	}
 }
 
@@ -483,10 +1313,121 @@ func NewTable() *Table {
 	return NewTableWith(nil)
 }
 
+// FromMap creates a new property table with no secondary table, holding a
+// copy of the key-value pairs of m.
+func FromMap(m map[string]string) *Table {
+	p := NewTable()
+	p.SetAll(m)
+	return p
+}
+
+// Defaults returns the secondary table of p, searched for the keys not
+// present in the primary table, or nil if p has no defaults.
+func (p *Table) Defaults() *Table {
+	return p.defaults
+}
+
+// SetDefaults replaces the secondary table of p by d, which may be nil to
+// remove it. The table d isn't copied: later changes of d are visible
+// through p, and the same table can be shared on purpose as the defaults of
+// several tables. The defaults chain of d must not lead back to p.
+func (p *Table) SetDefaults(d *Table) {
+	p.defaults = d
+}
+
+// WithProfile returns a new table in which a key K resolves to the value of
+// the key K.<profile> if present, else to the value of K. The returned table
+// has p as its secondary table, and its primary table holds, for each key
+// ending with "." followed by profile and found by Lookup in p (searching
+// its secondary tables too), the value of that key under the key without
+// the suffix. Thus a profile key overrides the plain key at every level of
+// the defaults chain of p. The profile keys are read when WithProfile is
+// called; later changes of p are visible through the returned table only for
+// the keys not overridden by the profile.
+func (p *Table) WithProfile(profile string) *Table {
+	t := NewTableWith(p)
+	suffix := "." + profile
+	for key, value := range p.flatten() {
+		if strings.HasSuffix(key, suffix) && len(key) > len(suffix) {
+			t.Set(key[:len(key)-len(suffix)], value)
+		}
+	}
+	return t
+}
+
+// Sub returns a new table holding the properties whose keys start with
+// prefix, with the prefix removed from the keys, so that "db.host" becomes
+// "host" with the prefix "db.". The properties are gathered from the primary
+// and the secondary tables and the fallback values, each key appearing once
+// with the value found by Lookup. With an empty prefix, the returned table
+// holds all the properties found by Lookup. The returned table has no
+// secondary table and is independent of p.
+func (p *Table) Sub(prefix string) *Table {
+	t := NewTable()
+	for key, value := range p.flatten() {
+		if strings.HasPrefix(key, prefix) {
+			t.Set(key[len(prefix):], value)
+		}
+	}
+	return t
+}
+
+// Filter returns a new table holding the key-value pairs of the primary
+// table for which keep returns true. The pairs of the secondary table are
+// not considered, and the returned table has no secondary table, so that the
+// keys left out can't be found through it. If p is in the ordered mode, so
+// is the returned table, with the keys in the same order. The returned table
+// is independent of p, which is left unchanged.
+func (p *Table) Filter(keep func(key, value string) bool) *Table {
+	t := NewTable()
+	t.SetOrdered(p.Ordered())
+	for _, key := range p.keys() {
+		if value := p.data[key]; keep(key, value) {
+			t.Set(key, value)
+		}
+	}
+	return t
+}
+
+// GetIndexed returns the tables described by indexed keys, such as
+// "server.0.host" and "server.1.host" with the prefix "server.". The table
+// at index i holds, for each key made of prefix, the decimal number i and a
+// '.', followed by a non-empty name, the value of that key under the name
+// alone. The keys are searched in the primary and in the secondary tables.
+// The indexes start from 0 and the slice stops before the first missing
+// index, so that the keys whose index follows a gap are ignored. The
+// indexes with leading zeros, like "01", aren't recognized. The returned
+// tables are independent of p.
+func (p *Table) GetIndexed(prefix string) []*Table {
+	tables := make(map[int]*Table)
+	for key, value := range p.flatten() {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		index, name, found := strings.Cut(key[len(prefix):], ".")
+		if !found || name == "" {
+			continue
+		}
+		i, e := strconv.Atoi(index)
+		if e != nil || i < 0 || strconv.Itoa(i) != index {
+			continue
+		}
+		if tables[i] == nil {
+			tables[i] = NewTable()
+		}
+		tables[i].Set(name, value)
+	}
+	var result []*Table
+	for i := 0; tables[i] != nil; i++ {
+		result = append(result, tables[i])
+	}
+	return result
+}
+
 // Lookup searches the value associated with key. If key isn't present in the
-// primary table, the function searches the secondary table. It returns the
-// value (or the empty string) and a boolean indicating whether the value was
-// found or not.
+// primary table, the function searches the secondary table, then the
+// fallback values registered with SetFallback. It returns the value (or the
+// empty string) and a boolean indicating whether the value was found or not.
 func (p *Table) Lookup(key string) (string, bool) {
 	if value, found := p.data[key]; found {
 		return value, true
@@ -496,9 +1437,165 @@ func (p *Table) Lookup(key string) (string, bool) {
 			return value, true
 		}
 	}
+	if value, found := p.fallbacks[key]; found {
+		return value, true
+	}
 	return "", false
 }
 
+// HasFold reports whether key is found by Lookup, or, failing that, whether
+// a key equal to it under Unicode case-folding is present in the primary
+// table, the secondary tables, or the fallback values. The storage of the
+// table is not affected: only this check is case-insensitive.
+func (p *Table) HasFold(key string) bool {
+	if _, found := p.Lookup(key); found {
+		return true
+	}
+	for t := p; t != nil; t = t.defaults {
+		for k := range t.data {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+		for k := range t.fallbacks {
+			if strings.EqualFold(k, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Contains reports whether key is found by Lookup, in the primary table,
+// the secondary tables, or the fallback values, even if its value is empty.
+func (p *Table) Contains(key string) bool {
+	_, found := p.Lookup(key)
+	return found
+}
+
+// ContainsLocal reports whether key is present in the primary table, even
+// if its value is empty. The secondary tables and the fallback values are
+// not searched.
+func (p *Table) ContainsLocal(key string) bool {
+	_, found := p.data[key]
+	return found
+}
+
+// HasAny reports whether at least one of the keys is found by Lookup, in
+// the primary table, the secondary tables, or the fallback values. It stops
+// at the first key found, and returns false if no key is given.
+func (p *Table) HasAny(keys ...string) bool {
+	for _, key := range keys {
+		if _, found := p.Lookup(key); found {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAll reports whether every one of the keys is found by Lookup, in the
+// primary table, the secondary tables, or the fallback values. It stops at
+// the first key missing, and returns true if no key is given.
+func (p *Table) HasAll(keys ...string) bool {
+	for _, key := range keys {
+		if _, found := p.Lookup(key); !found {
+			return false
+		}
+	}
+	return true
+}
+
+// SetLine parses line as done by ParseEntry and sets the key-value pair it
+// holds in the primary table. This allows feeding overrides like the ones
+// given on the command line ("key=value" or "key:value"). It returns the
+// error of ParseEntry, if any, without modifying the table.
+func (p *Table) SetLine(line string) error {
+	key, value, e := ParseEntry(line)
+	if e != nil {
+		return e
+	}
+	p.Set(key, value)
+	return nil
+}
+
+// SetLines calls SetLine for each of the lines. The valid lines are set
+// even if some lines can't be parsed. It returns nil if all the lines are
+// valid, otherwise an ErrorList holding the errors, in the order of the
+// lines.
+func (p *Table) SetLines(lines []string) error {
+	var errs ErrorList
+	for _, line := range lines {
+		if e := p.SetLine(line); e != nil {
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// SetFallback registers value as the fallback value of key. The fallback
+// values are kept apart from the key-value pairs of the table: they are
+// consulted by Lookup (and by the functions built on it) only after the
+// primary and the secondary tables, they are not written out by Store and
+// they are not removed by Clear. This allows registering defaults in code,
+// distinct from the defaults loaded from files. The fallback values of a
+// secondary table are consulted as part of the secondary table, before the
+// ones of the primary table.
+func (p *Table) SetFallback(key, value string) {
+	if p.fallbacks == nil {
+		p.fallbacks = make(map[string]string)
+	}
+	p.fallbacks[key] = value
+}
+
+// flatten returns a new map holding every key-value pair found by Lookup: the
+// pairs of the primary table, of all the secondary tables, and the fallback
+// values. The pairs in the primary table override the ones in the secondary
+// tables, which override the fallback values.
+func (p *Table) flatten() map[string]string {
+	data := make(map[string]string, len(p.data)+len(p.fallbacks))
+	for key, value := range p.fallbacks {
+		data[key] = value
+	}
+	if p.defaults != nil {
+		for key, value := range p.defaults.flatten() {
+			data[key] = value
+		}
+	}
+	for key, value := range p.data {
+		data[key] = value
+	}
+	return data
+}
+
+// ToMap returns a new map holding the key-value pairs of the primary table.
+// The pairs of the secondary table are not included. The map is a fresh
+// copy, which the caller may modify without affecting the table.
+func (p *Table) ToMap() map[string]string {
+	m := make(map[string]string, len(p.data))
+	maps.Copy(m, p.data)
+	return m
+}
+
+// ToMapResolved returns a new map holding every key-value pair found by
+// Lookup, that is the effective content of the table: the pairs of the
+// primary table override the ones of the secondary tables, which override
+// the fallback values. The map is a fresh copy, which the caller may modify
+// without affecting the table.
+func (p *Table) ToMapResolved() map[string]string {
+	return p.flatten()
+}
+
+// Resolved returns a new table with no secondary table, holding every
+// key-value pair found by Lookup, that is the effective content of p, as
+// returned by ToMapResolved. Storing it shows the values in effect without
+// the layering of the defaults. The returned table is independent of p.
+func (p *Table) Resolved() *Table {
+	return FromMap(p.flatten())
+}
+
 // Get returns the value associated with the string key. If key isn't present
 // in the primary table, it searches the secondary table. If the key isn't
 // found, returns the empty string.
@@ -507,22 +1604,644 @@ func (p *Table) Get(key string) string {
 	return value
 }
 
+// GetOr returns the value associated with key, searched as by Lookup, or
+// fallback if the key isn't found. A key whose value is the empty string is
+// found, so that GetOr returns the empty string and not fallback.
+func (p *Table) GetOr(key, fallback string) string {
+	if value, found := p.Lookup(key); found {
+		return value
+	}
+	return fallback
+}
+
+// GetFirstNonEmpty returns the value of the first key, in the given order,
+// whose value is not empty. Each key is searched in the primary and in the
+// secondary tables, like Get. Unlike a presence check (see Lookup), a key
+// explicitly set to the empty string is skipped in favor of the next one.
+// If no key has a non-empty value, it returns the empty string.
+func (p *Table) GetFirstNonEmpty(keys ...string) string {
+	for _, key := range keys {
+		if value := p.Get(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// ByteSize holds the total length, in bytes, of the keys and of the values of
+// a property table.
+type ByteSize struct {
+	KeyBytes   int
+	ValueBytes int
+}
+
+// ShadowedKeys returns the keys present in the primary table and also found
+// by Lookup in the secondary table, in lexicographic order. The values of
+// these keys in the secondary table are shadowed by the primary table.
+func (p *Table) ShadowedKeys() []string {
+	keys := []string{}
+	if p.defaults == nil {
+		return keys
+	}
+	defaults := p.defaults.flatten()
+	for _, key := range sortedKeys(p.data) {
+		if _, found := defaults[key]; found {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// SizeBreakdown returns the total length, in bytes, of the keys and of the
+// values of the primary table. The lengths are those of the strings, not of
+// their escaped form.
+func (p *Table) SizeBreakdown() ByteSize {
+	var size ByteSize
+	for key, value := range p.data {
+		size.KeyBytes += len(key)
+		size.ValueBytes += len(value)
+	}
+	return size
+}
+
+// SizeBytes returns the total length, in bytes, of the keys and the values
+// of the primary table, as given by SizeBreakdown.
+func (p *Table) SizeBytes() int {
+	size := p.SizeBreakdown()
+	return size.KeyBytes + size.ValueBytes
+}
+
+// Keys returns the keys of the primary table, in lexicographic order. The
+// keys found only in the secondary table are not included. The slice is a
+// fresh copy, which the caller may modify.
+func (p *Table) Keys() []string {
+	return sortedKeys(p.data)
+}
+
+// Values returns the values of the primary table, in the lexicographic order
+// of their keys, so that the value at index i is associated with the key at
+// index i of the slice returned by Keys, as long as the table isn't modified
+// in between. The values found only in the secondary table are not included.
+// The slice is a fresh copy, which the caller may modify.
+func (p *Table) Values() []string {
+	keys := sortedKeys(p.data)
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = p.data[key]
+	}
+	return values
+}
+
+// Len returns the number of key-value pairs in the primary table.
+func (p *Table) Len() int {
+	return len(p.data)
+}
+
+// LenAll returns the number of distinct keys found by Lookup, in the primary
+// table, in the secondary tables and among the fallback values, a key present
+// in several of them being counted once. If the table has neither defaults
+// nor fallback values, LenAll is equal to Len.
+func (p *Table) LenAll() int {
+	if p.defaults == nil && len(p.fallbacks) == 0 {
+		return len(p.data)
+	}
+	return len(p.flatten())
+}
+
+// IsEmpty reports whether the primary table holds no key-value pair. The
+// secondary table is ignored: IsEmpty is equivalent to Len() == 0.
+func (p *Table) IsEmpty() bool {
+	return len(p.data) == 0
+}
+
+// IsEmptyResolved reports whether Lookup finds no key at all, neither in the
+// primary table, nor in the secondary tables, nor among the fallback values,
+// that is whether LenAll returns 0.
+func (p *Table) IsEmptyResolved() bool {
+	return p.LenAll() == 0
+}
+
+// PropertyNames returns the keys found by Lookup, in the primary table, in
+// the secondary tables and among the fallback values, in lexicographic order,
+// each key appearing once even if it's present in several of them. The slice
+// is a fresh copy, which the caller may modify.
+func (p *Table) PropertyNames() []string {
+	return sortedKeys(p.flatten())
+}
+
+// KeysWithPrefix returns the keys found by Lookup starting with prefix, such
+// as "plugin.a" and "plugin.b" with the prefix "plugin.", in lexicographic
+// order, each key appearing once even if it's present in several tables. The
+// keys are those of PropertyNames, including the keys of the fallback values,
+// so that they are the keys of Sub(prefix) with the prefix added back. With
+// an empty prefix, it returns the same keys as PropertyNames. The slice is a
+// fresh copy, which the caller may modify.
+func (p *Table) KeysWithPrefix(prefix string) []string {
+	keys := make([]string, 0)
+	for _, key := range p.PropertyNames() {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// SortedEntries returns the key-value pairs of the primary table, in the
+// lexicographic order of the keys. The pairs of the secondary table are not
+// included.
+func (p *Table) SortedEntries() []Entry {
+	entries := make([]Entry, 0, len(p.data))
+	for _, key := range sortedKeys(p.data) {
+		entries = append(entries, Entry{key, p.data[key]})
+	}
+	return entries
+}
+
+// RangeWhere calls f for each key-value pair of the primary table for which
+// pred returns true, in no particular order, stopping as soon as f returns
+// false. If pred is nil, f is called for every pair. Only the primary table
+// is scanned, the defaults table (if any) is ignored. The pairs are visited
+// in a single pass, without building an intermediate table.
+func (p *Table) RangeWhere(pred func(key, value string) bool, f func(key, value string) bool) {
+	for key, value := range p.data {
+		if pred != nil && !pred(key, value) {
+			continue
+		}
+		if !f(key, value) {
+			return
+		}
+	}
+}
+
 // Set associates key with value in the property table. If key is already
-// present in the table, the associated value is replaced.
+// present in the table, the associated value is replaced. The empty string
+// is a valid key, which Store writes and Load reads back like any other.
 func (p *Table) Set(key string, value string) {
+	if p.data == nil {
+		p.data = make(map[string]string)
+	}
 	p.data[key] = value
+	if _, found := p.seq[key]; !found && p.seq != nil {
+		p.seq[key] = p.next
+		p.next += 1
+	}
+	p.dirty = true
+}
+
+// SetKeyValidator sets the function checking the keys set by TrySet, and
+// loaded by LoadWith with the ValidateKeys option. The function returns nil
+// to accept a key, or an error telling why it's rejected. A nil function,
+// which is the default, accepts every key. Set and the other functions
+// setting keys don't check them. The validator is copied by Clone.
+func (p *Table) SetKeyValidator(fn func(string) error) {
+	p.validator = fn
+}
+
+// TrySet associates key with value as done by Set, after checking key with
+// the validator set by SetKeyValidator, if any. If the validator rejects the
+// key, the table isn't modified and the error returned names the key and
+// wraps the error of the validator.
+func (p *Table) TrySet(key, value string) error {
+	if p.validator != nil {
+		if e := p.validator(key); e != nil {
+			return keyError(key, e)
+		}
+	}
+	p.Set(key, value)
+	return nil
+}
+
+// SetIfAbsent associates key with value only if key isn't present in the
+// primary table, and reports whether it did. The secondary table is ignored:
+// a key found only there is still set, overriding the default value, so
+// that the defaults can be seeded in code without clobbering the values
+// already set or loaded.
+func (p *Table) SetIfAbsent(key, value string) bool {
+	if _, found := p.data[key]; found {
+		return false
+	}
+	p.Set(key, value)
+	return true
+}
+
+// EnsureKeys sets each of the keys missing from the primary table to
+// placeholder, leaving the keys already present untouched. The secondary
+// table is ignored: a key found only there is still set. This is useful to
+// produce skeleton files showing all the expected keys. It returns the
+// number of keys added.
+func (p *Table) EnsureKeys(placeholder string, keys ...string) int {
+	count := 0
+	for _, key := range keys {
+		if _, found := p.data[key]; !found {
+			p.Set(key, placeholder)
+			count += 1
+		}
+	}
+	return count
+}
+
+// ChangedKeys returns the keys present in the primary tables of both p and
+// other, whose values differ, in lexicographic order. The secondary tables
+// are not compared.
+func (p *Table) ChangedKeys(other *Table) []string {
+	keys := []string{}
+	for _, key := range sortedKeys(p.data) {
+		if value, found := other.data[key]; found && value != p.data[key] {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Diff compares the primary tables of p and other. It returns the keys
+// present in other but not in p, the keys present in p but not in other,
+// and the keys present in both whose values differ, as done by ChangedKeys.
+// Each slice is in lexicographic order. The secondary tables are not
+// compared.
+func (p *Table) Diff(other *Table) (added, removed, changed []string) {
+	added = []string{}
+	for _, key := range sortedKeys(other.data) {
+		if _, found := p.data[key]; !found {
+			added = append(added, key)
+		}
+	}
+	removed = []string{}
+	for _, key := range sortedKeys(p.data) {
+		if _, found := other.data[key]; !found {
+			removed = append(removed, key)
+		}
+	}
+	return added, removed, p.ChangedKeys(other)
+}
+
+// Tombstone is the value marking, in the tables returned by DiffTable, a key
+// removed from the compared table. It's a single NUL character, which isn't
+// expected in property values.
+const Tombstone = "\x00"
+
+// DiffTable returns a new table holding the changes needed to turn the
+// primary table of p into the primary table of other: the keys added or
+// changed in other, with their values in other, and the keys removed from
+// other, with the value Tombstone. The secondary tables are not compared.
+// The result can be applied to a table with ApplyDiff.
+func (p *Table) DiffTable(other *Table) *Table {
+	diff := NewTable()
+	for key, value := range other.data {
+		if old, found := p.data[key]; !found || old != value {
+			diff.Set(key, value)
+		}
+	}
+	for key := range p.data {
+		if _, found := other.data[key]; !found {
+			diff.Set(key, Tombstone)
+		}
+	}
+	return diff
+}
+
+// ApplyDiff applies to the primary table the changes held by diff, as
+// returned by DiffTable: the keys whose value is Tombstone are deleted, the
+// other keys are set to their values in diff.
+func (p *Table) ApplyDiff(diff *Table) {
+	for key, value := range diff.data {
+		if value == Tombstone {
+			p.Delete(key)
+		} else {
+			p.Set(key, value)
+		}
+	}
+}
+
+// SetAll sets in the primary table every key-value pair of m, overwriting
+// the keys already present. The pairs are set in the lexicographic order of
+// the keys, which is their order in the ordered mode (see SetOrdered). The
+// map m isn't retained by the table.
+func (p *Table) SetAll(m map[string]string) {
+	for _, key := range sortedKeys(m) {
+		p.Set(key, m[key])
+	}
+}
+
+// Merge sets in the primary table every key-value pair of the primary table
+// of other, overwriting the keys already present. The pairs are set in the
+// order they're written by Store for other. The secondary tables and the
+// fallback values of other are not merged, and other isn't modified.
+func (p *Table) Merge(other *Table) {
+	for _, key := range other.keys() {
+		p.Set(key, other.data[key])
+	}
+}
+
+// MergeKeeping sets in the primary table the key-value pairs of the primary
+// table of other whose keys aren't already present in the primary table of
+// p, filling in the missing keys only. The secondary tables and the fallback
+// values of other are not merged, and other isn't modified.
+func (p *Table) MergeKeeping(other *Table) {
+	for _, key := range other.keys() {
+		if _, found := p.data[key]; !found {
+			p.Set(key, other.data[key])
+		}
+	}
 }
 
 // Delete removes the key and the associated value from the property table.
 // If the key isn't present, calling this function does nothing.
 func (p *Table) Delete(key string) {
-	delete(p.data, key)
+	if _, found := p.data[key]; found {
+		delete(p.data, key)
+		p.dirty = true
+	}
+	delete(p.lines, key)
+	delete(p.inline, key)
+	delete(p.comments, key)
+	delete(p.seq, key)
+}
+
+// GetAndDelete returns the value associated with key in the primary table
+// and deletes the key, as done by Delete. It returns false if the key isn't
+// present in the primary table, in which case the table isn't modified. The
+// secondary table is neither searched nor modified: a key found only there
+// is reported as absent.
+func (p *Table) GetAndDelete(key string) (string, bool) {
+	value, found := p.data[key]
+	if found {
+		p.Delete(key)
+	}
+	return value, found
+}
+
+// DeletePrefix deletes, as done by Delete, the keys of the primary table
+// starting with prefix, such as "db.host" and "db.port" with the prefix
+// "db.", and returns the number of keys deleted. With an empty prefix, it
+// deletes all the keys, as done by Clear. The secondary table is never
+// modified.
+func (p *Table) DeletePrefix(prefix string) int {
+	if prefix == "" {
+		count := len(p.data)
+		p.Clear()
+		return count
+	}
+	return p.DeleteFunc(func(key, value string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+// DeleteFunc deletes, as done by Delete, the keys of the primary table for
+// which pred returns true, and returns the number of keys deleted. The keys
+// are collected before pred is first called, in lexicographic order, so pred
+// may safely read the table. The secondary table is never modified.
+func (p *Table) DeleteFunc(pred func(key, value string) bool) int {
+	count := 0
+	for _, key := range sortedKeys(p.data) {
+		if pred(key, p.data[key]) {
+			p.Delete(key)
+			count += 1
+		}
+	}
+	return count
+}
+
+// Rename moves the value associated with oldKey in the primary table to
+// newKey, then deletes oldKey. If newKey is already present in the primary
+// table, its value is overwritten. The comments of oldKey, set by SetComment
+// and SetInlineComment, move along with the value and replace the ones of
+// newKey. It returns whether oldKey was present in the primary table; if
+// not, the table isn't modified. The secondary table is never modified: a
+// key found only there isn't renamed.
+func (p *Table) Rename(oldKey, newKey string) bool {
+	value, found := p.data[oldKey]
+	if !found {
+		return false
+	}
+	if oldKey == newKey {
+		return true
+	}
+	comment, commented := p.inline[oldKey]
+	above := p.comments[oldKey]
+	p.Delete(oldKey)
+	p.Set(newKey, value)
+	p.setInlineComment(newKey, comment, commented)
+	p.SetComment(newKey, above)
+	return true
 }
 
 // Clear deletes all the key-value pairs in the primary table. It doesn't
 // delete the pairs in the secondary table.
 func (p *Table) Clear() {
+	if len(p.data) > 0 {
+		p.dirty = true
+	}
 	p.data = make(map[string]string)
+	p.lines = nil
+	p.inline = nil
+	p.comments = nil
+	p.doc = nil
+	p.separators = nil
+	if p.seq != nil {
+		p.seq = make(map[string]int)
+	}
+}
+
+// Dirty reports whether the key-value pairs of the primary table were
+// modified since the table was created or last written out by Store,
+// StoreWith or Save (and the functions built on them). The table is marked
+// as modified by any function setting a key (even to the same value), by
+// any function deleting an existing key, and by Load setting any key.
+// Writing out only some of the entries or transformed entries, like
+// StoreSubset and StoreTransform do, doesn't reset the mark.
+func (p *Table) Dirty() bool {
+	return p.dirty
+}
+
+// Line returns the number, starting from 1, of the input line where key was
+// defined, and a boolean indicating whether the number is known. The numbers
+// are recorded by LoadWith with the Lines option set, for the keys of the
+// primary table. If a definition spreads across several lines, the number of
+// its first line is returned. If a key is defined several times, the number
+// of the last definition is returned. Setting a key keeps its line number,
+// deleting it forgets the number.
+func (p *Table) Line(key string) (int, bool) {
+	line, found := p.lines[key]
+	return line, found
+}
+
+// SetInlineComment sets the comment written by Store on the line of key,
+// after the value, as in "port=8080 # default". The comment is written only
+// while key is in the primary table; deleting the key deletes its comment.
+// The surrounding space of text is dropped and any line terminator in text
+// is replaced by a space. If text is then empty, the comment of key is
+// removed. The comments are read back by LoadWith with the InlineComments
+// option set.
+func (p *Table) SetInlineComment(key, text string) {
+	text = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(text)
+	text = strings.TrimSpace(text)
+	p.setInlineComment(key, text, text != "")
+}
+
+// setInlineComment sets the inline comment of key to text if found is true,
+// or removes it otherwise, marking the table as modified if the comment
+// changes.
+func (p *Table) setInlineComment(key, text string, found bool) {
+	old, had := p.inline[key]
+	if !found {
+		if had {
+			delete(p.inline, key)
+			p.dirty = true
+		}
+		return
+	}
+	if p.inline == nil {
+		p.inline = make(map[string]string)
+	}
+	p.inline[key] = text
+	if !had || old != text {
+		p.dirty = true
+	}
+}
+
+// InlineComment returns the comment written on the line of key, after the
+// value, as set by SetInlineComment or loaded with the InlineComments
+// option. It returns the empty string if key has no inline comment.
+func (p *Table) InlineComment(key string) string {
+	return p.inline[key]
+}
+
+// SetComment sets the comment written by Store on the lines preceding the
+// line of key, formatted like the comments of Save: each line of text is
+// written prefixed by a '#', unless it already starts with '#' or '!'. The
+// comment is written only while key is in the primary table; deleting the
+// key deletes its comment. If text is empty, the comment of key is removed.
+// The comments aren't read back by Load.
+func (p *Table) SetComment(key, text string) {
+	old, had := p.comments[key]
+	if text == "" {
+		if had {
+			delete(p.comments, key)
+			p.dirty = true
+		}
+		return
+	}
+	if p.comments == nil {
+		p.comments = make(map[string]string)
+	}
+	p.comments[key] = text
+	if !had || old != text {
+		p.dirty = true
+	}
+}
+
+// Comment returns the comment written on the lines preceding the line of
+// key, as set by SetComment. It returns the empty string if key has no
+// comment.
+func (p *Table) Comment(key string) string {
+	return p.comments[key]
+}
+
+// Clone returns a deep copy of the table, sharing no mutable state with p:
+// the primary table, the fallback values, the recorded line numbers and
+// comments are copied, and the secondary table (if any) is cloned in turn.
+// Modifying or clearing the clone doesn't affect p, and conversely.
+func (p *Table) Clone() *Table {
+	t := &Table{
+		data:        maps.Clone(p.data),
+		fallbacks:   maps.Clone(p.fallbacks),
+		separators:  maps.Clone(p.separators),
+		lines:       maps.Clone(p.lines),
+		inline:      maps.Clone(p.inline),
+		comments:    maps.Clone(p.comments),
+		seq:         maps.Clone(p.seq),
+		next:        p.next,
+		doc:         slices.Clone(p.doc),
+		validator:   p.validator,
+		trueValues:  p.trueValues,
+		falseValues: p.falseValues,
+		dirty:       p.dirty,
+	}
+	if t.data == nil {
+		t.data = make(map[string]string)
+	}
+	if p.defaults != nil {
+		t.defaults = p.defaults.Clone()
+	}
+	return t
+}
+
+// Equal reports whether the primary tables of p and other hold exactly the
+// same key-value pairs. The secondary tables and the fallback values are not
+// compared.
+func (p *Table) Equal(other *Table) bool {
+	return maps.Equal(p.data, other.data)
+}
+
+// EqualResolved reports whether p and other resolve the same keys to the
+// same values, that is whether Lookup returns the same results for every
+// key on both tables. The key-value pairs may be spread differently over the
+// primary and the secondary tables: a table without defaults and a table
+// with an empty defaults table are equal if their primary tables are.
+func (p *Table) EqualResolved(other *Table) bool {
+	return maps.Equal(p.flatten(), other.flatten())
+}
+
+// Intern makes the equal values of the table share the same storage, which
+// reduces the memory used by large tables holding many copies of the same
+// values, as loaded from files. The values of the primary and of the
+// secondary tables are interned together. The key-value pairs are left
+// unchanged and the table isn't marked as modified.
+func (p *Table) Intern() {
+	pool := make(map[string]string)
+	for t := p; t != nil; t = t.defaults {
+		for key, value := range t.data {
+			if v, found := pool[value]; found {
+				t.data[key] = v
+			} else {
+				pool[value] = value
+			}
+		}
+	}
+}
+
+// SetOrdered selects the order in which Store, StoreWith, Save and String
+// write the key-value pairs of the primary table. If ordered is true, the
+// pairs are written in the order their keys were first set or loaded, so
+// that the files curated by hand keep their layout: setting an existing key
+// again keeps its position, deleting a key forgets its position, and a key
+// set again after being deleted goes last. The keys already in the table
+// when the ordered mode is turned on are placed first, in lexicographic
+// order. If ordered is false, the pairs are written in the lexicographic
+// order of the keys, which is the default.
+func (p *Table) SetOrdered(ordered bool) {
+	if !ordered {
+		p.seq = nil
+		p.next = 0
+		return
+	}
+	if p.seq != nil {
+		return
+	}
+	p.seq = make(map[string]int, len(p.data))
+	p.next = 0
+	for _, key := range sortedKeys(p.data) {
+		p.seq[key] = p.next
+		p.next += 1
+	}
+}
+
+// Ordered reports whether the pairs are written in insertion order, as set
+// by SetOrdered.
+func (p *Table) Ordered() bool {
+	return p.seq != nil
+}
+
+// keys returns the keys of the primary table in the order they're written:
+// in insertion order in the ordered mode, in lexicographic order otherwise.
+func (p *Table) keys() []string {
+	keys := sortedKeys(p.data)
+	if p.seq != nil {
+		sort.SliceStable(keys, func(i, j int) bool {
+			return p.seq[keys[i]] < p.seq[keys[j]]
+		})
+	}
+	return keys
 }
 
 // ClearAll deletes all the key-value pairs in the primary and the secondary
@@ -1,7 +1,17 @@
 package properties
 
 import (
+	"context"
+	"errors"
+	"io"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
+	"unsafe"
 )
 
 func TestLoadString(t *testing.T) {
@@ -100,3 +110,1762 @@ func TestDefaults(t *testing.T) {
 		t.Error("SaveString() returned ", s)
 	}
 }
+
+func TestStoreTransform(t *testing.T) {
+	var b strings.Builder
+	p := NewTable()
+	p.Set("user", "admin")
+	p.Set("password", "secret")
+	p.Set("internal", "drop me")
+	n, e := p.StoreTransform(&b, func(key, value string) (string, string, bool) {
+		if key == "password" {
+			return key, "***", true
+		}
+		if key == "user" {
+			return "login", value, true
+		}
+		return key, value, false
+	}, false)
+	if n != 2 || e != nil {
+		t.Error("StoreTransform() returned ", n, e)
+	}
+	s := b.String()
+	if !strings.Contains(s, "login=admin\n") || !strings.Contains(s, "password=***\n") {
+		t.Error("StoreTransform() wrote ", s)
+	}
+	if p.Get("password") != "secret" {
+		t.Error(`p.Get("password") != "secret"`)
+	}
+}
+
+func TestGetFirstNonEmpty(t *testing.T) {
+	d := NewTable()
+	d.Set("host", "localhost")
+	p := NewTableWith(d)
+	p.Set("override.host", "")
+	if p.GetFirstNonEmpty("override.host", "host") != "localhost" {
+		t.Error(`p.GetFirstNonEmpty("override.host", "host") != "localhost"`)
+	}
+	p.Set("override.host", "example.com")
+	if p.GetFirstNonEmpty("override.host", "host") != "example.com" {
+		t.Error(`p.GetFirstNonEmpty("override.host", "host") != "example.com"`)
+	}
+	if p.GetFirstNonEmpty("missing", "other") != "" {
+		t.Error(`p.GetFirstNonEmpty("missing", "other") != ""`)
+	}
+}
+
+func TestFormfeed(t *testing.T) {
+	p := NewTable()
+	p.Set("page\fbreak", "\fbefore\fafter")
+	s := p.String()
+	if s != "page\\fbreak=\\fbefore\\fafter\n" {
+		t.Error("String() returned ", s)
+	}
+	q := NewTable()
+	q.LoadString(s)
+	if q.Get("page\fbreak") != "\fbefore\fafter" {
+		t.Error(`q.Get("page\fbreak") != "\fbefore\fafter"`)
+	}
+	p.Clear()
+	p.Set("tab", "\tleading")
+	var b strings.Builder
+	p.Store(&b, true)
+	q.Clear()
+	q.LoadString(b.String())
+	if q.Get("tab") != "\tleading" {
+		t.Error("Store() wrote ", b.String())
+	}
+}
+
+func TestLoadMultipleLines(t *testing.T) {
+	p := NewTable()
+	n, e := p.Load(strings.NewReader("first=1\nsecond=2\r\nthird=3"))
+	if n != 3 || e != nil {
+		t.Error("p.Load(...) returned ", n, e)
+	}
+	if p.Get("first") != "1" || p.Get("second") != "2" || p.Get("third") != "3" {
+		t.Errorf("p.Load(...) loaded %q", p.String())
+	}
+}
+
+// latin1Reader decodes ISO-8859-1 input to UTF-8.
+type latin1Reader struct {
+	r io.Reader
+}
+
+func (l latin1Reader) Read(p []byte) (int, error) {
+	var b [1]byte
+	n := 0
+	for n+utf8.UTFMax <= len(p) {
+		if _, e := l.r.Read(b[:]); e != nil {
+			return n, e
+		}
+		n += utf8.EncodeRune(p[n:], rune(b[0]))
+	}
+	return n, nil
+}
+
+func TestLoadWithDecoder(t *testing.T) {
+	p := NewTable()
+	input := "caf\xe9 = cr\xe8me br\xfbl\xe9e\n# comment\nna\xefve:fa\xe7ade\n"
+	n, e := p.LoadWith(strings.NewReader(input), LoadOptions{
+		Decoder: func(r io.Reader) io.Reader { return latin1Reader{r} },
+	})
+	if n != 2 || e != nil {
+		t.Error("LoadWith() returned ", n, e)
+	}
+	if p.Get("café") != "crème brûlée" {
+		t.Error(`p.Get("café") != "crème brûlée"`)
+	}
+	if p.Get("naïve") != "façade" {
+		t.Error(`p.Get("naïve") != "façade"`)
+	}
+}
+
+func TestSetFallback(t *testing.T) {
+	d := NewTable()
+	d.Set("port", "8080")
+	p := NewTableWith(d)
+	p.SetFallback("port", "80")
+	p.SetFallback("host", "localhost")
+	if p.Get("port") != "8080" {
+		t.Error(`p.Get("port") != "8080"`)
+	}
+	if p.Get("host") != "localhost" {
+		t.Error(`p.Get("host") != "localhost"`)
+	}
+	p.Set("host", "example.com")
+	if p.Get("host") != "example.com" {
+		t.Error(`p.Get("host") != "example.com"`)
+	}
+	p.Clear()
+	if p.Get("host") != "localhost" {
+		t.Error(`p.Get("host") != "localhost"`)
+	}
+	if s := p.String(); s != "" {
+		t.Error("String() returned ", s)
+	}
+}
+
+func TestStoreSubset(t *testing.T) {
+	var b strings.Builder
+	d := NewTable()
+	d.Set("db.user", "admin")
+	p := NewTableWith(d)
+	p.Set("db.host", "localhost")
+	p.Set("db.port", "5432")
+	p.Set("cache.ttl", "60")
+	n, e := p.StoreSubset(&b, "db.", false)
+	if n != 2 || e != nil {
+		t.Error("StoreSubset() returned ", n, e)
+	}
+	q := NewTable()
+	q.LoadString(b.String())
+	if q.Get("host") != "localhost" || q.Get("port") != "5432" || q.Get("user") != "" {
+		t.Error("StoreSubset() wrote ", b.String())
+	}
+}
+
+func TestFormatEntry(t *testing.T) {
+	if s := FormatEntry("third #key", " third !value", false); s != "third\\ \\#key=\\ third \\!value" {
+		t.Error("FormatEntry() returned ", s)
+	}
+	if s := FormatEntry("euro", "€", true); s != "euro=\\u20ac" {
+		t.Error("FormatEntry() returned ", s)
+	}
+	p := NewTable()
+	p.Set("key", "value with €")
+	if s := FormatEntry("key", "value with €", false) + "\n"; s != p.String() {
+		t.Error("FormatEntry() returned ", s)
+	}
+}
+
+func TestLoadKeyWithTrailingSpace(t *testing.T) {
+	p := NewTable()
+	if n, e := p.LoadString("first  \nsecond =  \t\nthird"); n != 3 || e != nil {
+		t.Error("p.LoadString(...) returned ", n, e)
+	}
+	for _, key := range []string{"first", "second", "third"} {
+		if v, found := p.Lookup(key); !found || v != "" {
+			t.Errorf("p.Lookup(%q) returned %q, %v", key, v, found)
+		}
+	}
+}
+
+func TestDominantSeparator(t *testing.T) {
+	p := NewTable()
+	if p.DominantSeparator() != '=' {
+		t.Error("DominantSeparator() returned ", p.DominantSeparator())
+	}
+	p.LoadString("first: 1\nsecond = 2\nthird :3\nfourth 4\nfifth\n")
+	if p.DominantSeparator() != ':' {
+		t.Error("DominantSeparator() returned ", p.DominantSeparator())
+	}
+	if p.Get("fourth") != "4" || p.Get("fifth") != "" {
+		t.Error("LoadString() loaded ", p.String())
+	}
+	p.LoadString("sixth=6\nseventh=7\n")
+	if p.DominantSeparator() != '=' {
+		t.Error("DominantSeparator() returned ", p.DominantSeparator())
+	}
+	p = NewTable()
+	p.LoadString("a:1\nb:2\n")
+	p.Clear()
+	p.LoadString("c=3\n")
+	if p.DominantSeparator() != '=' {
+		t.Error("DominantSeparator() returned ", p.DominantSeparator(), " after Clear()")
+	}
+}
+
+func TestSortedEntries(t *testing.T) {
+	d := NewTable()
+	d.Set("default", "ignored")
+	p := NewTableWith(d)
+	p.Set("b", "2")
+	p.Set("c", "3")
+	p.Set("a", "1")
+	entries := p.SortedEntries()
+	if len(entries) != 3 || entries[0] != (Entry{"a", "1"}) || entries[2] != (Entry{"c", "3"}) {
+		t.Error("SortedEntries() returned ", entries)
+	}
+}
+
+func TestKeepContinuationIndent(t *testing.T) {
+	input := "languages  Assembly, Lisp, Pascal, \\\n" +
+		"           BASIC, C, \\\n" +
+		"           Go\n"
+	p := NewTable()
+	p.LoadWith(strings.NewReader(input), LoadOptions{})
+	if p.Get("languages") != "Assembly, Lisp, Pascal, BASIC, C, Go" {
+		t.Error(`p.Get("languages") returned `, p.Get("languages"))
+	}
+	p.LoadWith(strings.NewReader(input), LoadOptions{KeepContinuationIndent: true})
+	if p.Get("languages") != "Assembly, Lisp, Pascal,            BASIC, C,            Go" {
+		t.Error(`p.Get("languages") returned `, p.Get("languages"))
+	}
+}
+
+func TestEnsureKeys(t *testing.T) {
+	d := NewTable()
+	d.Set("db.user", "admin")
+	p := NewTableWith(d)
+	p.Set("db.host", "localhost")
+	if n := p.EnsureKeys("CHANGEME", "db.host", "db.user", "db.password"); n != 2 {
+		t.Error("EnsureKeys() returned ", n)
+	}
+	if p.Get("db.host") != "localhost" {
+		t.Error(`p.Get("db.host") != "localhost"`)
+	}
+	if p.Get("db.user") != "CHANGEME" || p.Get("db.password") != "CHANGEME" {
+		t.Error("EnsureKeys() set ", p.String())
+	}
+}
+
+func TestStoreWithHeaderFooter(t *testing.T) {
+	var b strings.Builder
+	p := NewTable()
+	p.Set("key", "value")
+	n, e := p.StoreWith(&b, StoreOptions{
+		Header: "DO NOT EDIT\ngenerated file",
+		Footer: "checksum: 1234",
+	})
+	if n != 1 || e != nil {
+		t.Error("StoreWith() returned ", n, e)
+	}
+	if b.String() != "#DO NOT EDIT\n#generated file\nkey=value\n#checksum: 1234\n" {
+		t.Error("StoreWith() wrote ", b.String())
+	}
+	b.Reset()
+	p.StoreWith(&b, StoreOptions{})
+	if b.String() != "key=value\n" {
+		t.Error("StoreWith() wrote ", b.String())
+	}
+}
+
+func TestStoreWithBlankBetween(t *testing.T) {
+	var b strings.Builder
+	p := NewTable()
+	p.Set("first", "1")
+	p.Set("second", "2")
+	p.Set("third", "3")
+	p.StoreWith(&b, StoreOptions{BlankBetween: true})
+	s := b.String()
+	if len(s) != len("first=1\n\nsecond=2\n\nthird=3\n") || !strings.Contains(s, "\n\n") || strings.HasSuffix(s, "\n\n") {
+		t.Error("StoreWith() wrote ", s)
+	}
+	q := NewTable()
+	if n, e := q.LoadString(s); n != 3 || e != nil || q.Get("second") != "2" {
+		t.Error("LoadString() returned ", n, e)
+	}
+}
+
+func TestChangedKeys(t *testing.T) {
+	staging := NewTable()
+	staging.LoadString("host=staging\nport=80\ndebug=true\nname=app\n")
+	prod := NewTableWith(staging)
+	prod.LoadString("host=prod\nport=80\nname=application\nreplicas=3\n")
+	keys := staging.ChangedKeys(prod)
+	if len(keys) != 2 || keys[0] != "host" || keys[1] != "name" {
+		t.Error("ChangedKeys() returned ", keys)
+	}
+}
+
+func TestWithProfile(t *testing.T) {
+	d := NewTable()
+	d.LoadString("server.port=8080\nserver.port.prod=80\nserver.host=localhost\n")
+	p := NewTableWith(d)
+	p.LoadString("server.host.prod=example.com\nlog.level=debug\n")
+	prod := p.WithProfile("prod")
+	if prod.Get("server.port") != "80" || prod.Get("server.host") != "example.com" {
+		t.Error("WithProfile() returned ", prod.String())
+	}
+	if prod.Get("log.level") != "debug" {
+		t.Error(`prod.Get("log.level") != "debug"`)
+	}
+	dev := p.WithProfile("dev")
+	if dev.Get("server.port") != "8080" || dev.Get("server.host") != "localhost" {
+		t.Error("WithProfile() returned ", dev.String())
+	}
+}
+
+func TestDiffTable(t *testing.T) {
+	p := NewTable()
+	p.LoadString("host=staging\nport=80\ndebug=true\n")
+	other := NewTable()
+	other.LoadString("host=prod\nport=80\nreplicas=3\n")
+	diff := p.DiffTable(other)
+	if diff.Get("host") != "prod" || diff.Get("replicas") != "3" || diff.Get("debug") != Tombstone {
+		t.Error("DiffTable() returned ", diff.String())
+	}
+	if _, found := diff.Lookup("port"); found {
+		t.Error(`diff.Lookup("port") found the key`)
+	}
+	q := NewTable()
+	q.LoadString(diff.String())
+	p.ApplyDiff(q)
+	if len(p.ChangedKeys(other)) != 0 || p.Get("replicas") != "3" {
+		t.Error("ApplyDiff() returned ", p.String())
+	}
+	if _, found := p.Lookup("debug"); found {
+		t.Error(`p.Lookup("debug") found the key`)
+	}
+}
+
+func TestHasFold(t *testing.T) {
+	d := NewTable()
+	d.Set("Content-Type", "text/plain")
+	p := NewTableWith(d)
+	p.Set("Accept", "*/*")
+	if !p.HasFold("accept") || !p.HasFold("CONTENT-TYPE") || !p.HasFold("Accept") {
+		t.Error("HasFold() didn't find a present key")
+	}
+	if p.HasFold("content-length") {
+		t.Error(`p.HasFold("content-length") found a missing key`)
+	}
+	if p.Get("accept") != "" {
+		t.Error(`p.Get("accept") != ""`)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	var b strings.Builder
+	input := "# settings\ndb.host = localhost\ndb.password = secret\n\ncache.ttl : 60\n"
+	n, e := Filter(strings.NewReader(input), &b, func(key, value string) (string, string, bool) {
+		if key == "db.password" {
+			return key, "***", true
+		}
+		return strings.TrimPrefix(key, "db."), value, strings.HasPrefix(key, "db.")
+	}, false)
+	if n != 2 || e != nil {
+		t.Error("Filter() returned ", n, e)
+	}
+	if b.String() != "host=localhost\ndb.password=***\n" {
+		t.Error("Filter() wrote ", b.String())
+	}
+}
+
+func TestEscapeLatin1(t *testing.T) {
+	var b strings.Builder
+	p := NewTable()
+	p.Set("café", "crème\u0085中")
+	p.SetComment("café", "déjà vu")
+	p.StoreWith(&b, StoreOptions{Escape: EscapeLatin1})
+	if b.String() != "#d\xe9j\xe0 vu\ncaf\xe9=cr\xe8me\\u0085\\u4e2d\n" {
+		t.Errorf("StoreWith() wrote %q", b.String())
+	}
+	q := NewTable()
+	q.LoadWith(strings.NewReader(b.String()), LoadOptions{
+		Decoder: func(r io.Reader) io.Reader { return latin1Reader{r} },
+	})
+	if q.Get("café") != "crème\u0085中" {
+		t.Error(`q.Get("café") returned `, q.Get("café"))
+	}
+	p.SetComment("café", "")
+	b.Reset()
+	p.StoreWith(&b, StoreOptions{Escape: EscapeASCII})
+	if b.String() != "caf\\u00e9=cr\\u00e8me\\u0085\\u4e2d\n" {
+		t.Error("StoreWith() wrote ", b.String())
+	}
+	q = NewTable()
+	q.LoadString(b.String())
+	if q.Get("café") != "crème\u0085中" {
+		t.Error(`q.Get("café") returned `, q.Get("café"))
+	}
+}
+
+func TestSizeBytes(t *testing.T) {
+	d := NewTable()
+	d.Set("ignored", "default")
+	p := NewTableWith(d)
+	if p.SizeBytes() != 0 {
+		t.Error("SizeBytes() returned ", p.SizeBytes())
+	}
+	p.Set("key", "value")
+	p.Set("euro", "€")
+	if size := p.SizeBreakdown(); size != (ByteSize{7, 8}) {
+		t.Error("SizeBreakdown() returned ", size)
+	}
+	if p.SizeBytes() != 15 {
+		t.Error("SizeBytes() returned ", p.SizeBytes())
+	}
+}
+
+func TestLoadStrictCollisions(t *testing.T) {
+	input := "host=a\nhost\\ =b\n\\ host=c\nport=1\nport=2\n"
+	p := NewTable()
+	n, e := p.LoadWith(strings.NewReader(input), LoadOptions{})
+	if n != 5 || e != nil {
+		t.Error("LoadWith() returned ", n, e)
+	}
+	n, e = p.LoadWith(strings.NewReader(input), LoadOptions{Strict: true})
+	var errs ErrorList
+	if n != 5 || !errors.As(e, &errs) || len(errs) != 3 || !errors.Is(e, ErrKeyCollision) {
+		t.Fatal("LoadWith() returned ", n, e)
+	}
+	if errs[1].Error() != `properties: "host" and " host": keys collide after trimming` {
+		t.Error("errs[1] is ", errs[1])
+	}
+	if p.Get("host ") != "b" {
+		t.Error(`p.Get("host ") != "b"`)
+	}
+}
+
+func TestShadowedKeys(t *testing.T) {
+	base := NewTable()
+	base.LoadString("host=localhost\nport=80\n")
+	d := NewTableWith(base)
+	d.LoadString("user=admin\n")
+	p := NewTableWith(d)
+	if keys := p.ShadowedKeys(); len(keys) != 0 {
+		t.Error("ShadowedKeys() returned ", keys)
+	}
+	p.LoadString("user=root\nport=8080\nname=app\n")
+	keys := p.ShadowedKeys()
+	if len(keys) != 2 || keys[0] != "port" || keys[1] != "user" {
+		t.Error("ShadowedKeys() returned ", keys)
+	}
+}
+
+func TestLoadLines(t *testing.T) {
+	input := "# header\r\n\r\nfirst=1\rsecond = two \\\n    lines\n\n! comment\nthird:3\nfirst=one"
+	p := NewTable()
+	p.LoadWith(strings.NewReader(input), LoadOptions{Lines: true})
+	lines := map[string]int{"first": 9, "second": 4, "third": 8}
+	for key, line := range lines {
+		if n, found := p.Line(key); !found || n != line {
+			t.Error("p.Line(", key, ") returned ", n, found)
+		}
+	}
+	p.Delete("third")
+	if _, found := p.Line("third"); found {
+		t.Error(`p.Line("third") found the line`)
+	}
+	p.LoadString("fourth=4")
+	if _, found := p.Line("fourth"); found {
+		t.Error(`p.Line("fourth") found the line`)
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	entries := map[string]Entry{
+		"key=value":                     {"key", "value"},
+		"  db\\ host : local\\u0068ost": {"db host", "localhost"},
+		"key value \\\n   continued\n":  {"key", "value continued"},
+		"empty=":                        {"empty", ""},
+	}
+	for line, entry := range entries {
+		key, value, e := ParseEntry(line)
+		if e != nil || key != entry.Key || value != entry.Value {
+			t.Error("ParseEntry(", line, ") returned ", key, value, e)
+		}
+	}
+	for _, line := range []string{"", "   ", "# comment", "key", "first=1\nsecond=2", "a=1\n\nb=2", "a=1\n  \n# comment"} {
+		if _, _, e := ParseEntry(line); !errors.Is(e, ErrSyntax) {
+			t.Error("ParseEntry(", line, ") returned ", e)
+		}
+	}
+}
+
+func TestSetLines(t *testing.T) {
+	p := NewTable()
+	if e := p.SetLine("server.port=8080"); e != nil || p.Get("server.port") != "8080" {
+		t.Error("SetLine() returned ", e)
+	}
+	if e := p.SetLine("server.port"); !errors.Is(e, ErrSyntax) || p.Get("server.port") != "8080" {
+		t.Error("SetLine() returned ", e)
+	}
+	e := p.SetLines([]string{"host:example.com", "debug", "name = app", "# none"})
+	var errs ErrorList
+	if !errors.As(e, &errs) || len(errs) != 2 {
+		t.Error("SetLines() returned ", e)
+	}
+	if p.Get("host") != "example.com" || p.Get("name") != "app" {
+		t.Error("SetLines() set ", p.String())
+	}
+}
+
+func TestDirty(t *testing.T) {
+	var b strings.Builder
+	p := NewTable()
+	if p.Dirty() {
+		t.Error("NewTable() is dirty")
+	}
+	p.LoadString("key=value")
+	if !p.Dirty() {
+		t.Error("LoadString() didn't mark the table")
+	}
+	p.Store(&b, false)
+	if p.Dirty() {
+		t.Error("Store() didn't reset the mark")
+	}
+	p.Delete("missing")
+	p.StoreSubset(&b, "k", false)
+	if p.Dirty() {
+		t.Error("Delete() of a missing key marked the table")
+	}
+	p.Set("key", "other")
+	p.StoreSubset(&b, "k", false)
+	if !p.Dirty() {
+		t.Error("StoreSubset() reset the mark")
+	}
+	p.Save(&b, "", false)
+	p.Delete("key")
+	if !p.Dirty() {
+		t.Error("Delete() didn't mark the table")
+	}
+	p.StoreWith(&b, StoreOptions{})
+	p.Clear()
+	if p.Dirty() {
+		t.Error("Clear() of an empty table marked the table")
+	}
+	p.EnsureKeys("", "new")
+	if !p.Dirty() {
+		t.Error("EnsureKeys() didn't mark the table")
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	d := NewTable()
+	d.Set("default", "ignored")
+	p := NewTableWith(d)
+	p.Set("b", "\u00e9t\u00e9 \U0001F600")
+	p.Set("a key", " = #1")
+	p.Set("c", "line\nbreak")
+	want := "a\\ key=\\ = \\#1\nb=\\u00e9t\\u00e9 \\ud83d\\ude00\nc=line\\u000abreak\n"
+	if s := string(p.Canonical()); s != want {
+		t.Error("Canonical() returned ", s)
+	}
+	q := NewTable()
+	q.Set("c", "line\nbreak")
+	q.Set("a key", " = #1")
+	q.Set("b", "\u00e9t\u00e9 \U0001F600")
+	if string(q.Canonical()) != want {
+		t.Error("Canonical() depends on the order of insertion")
+	}
+	if b := NewTable().Canonical(); len(b) != 0 {
+		t.Error("Canonical() of an empty table returned ", b)
+	}
+	tab := FromMap(map[string]string{"k": "\t"})
+	escaped := FromMap(map[string]string{"k": `\u0009`, `C:\temp`: `\`})
+	if s := string(tab.Canonical()); s != "k=\\u0009\n" {
+		t.Error("Canonical() returned ", s)
+	}
+	if s := string(escaped.Canonical()); s != "C\\:\\\\temp=\\\\\nk=\\\\u0009\n" {
+		t.Error("Canonical() returned ", s)
+	}
+	r := NewTable()
+	if r.LoadString(escaped.String()); !r.Equal(escaped) {
+		t.Errorf("r.LoadString(...) loaded %q", r.String())
+	}
+}
+
+func TestRangeWhere(t *testing.T) {
+	d := NewTable()
+	d.Set("default", "")
+	p := NewTableWith(d)
+	p.Set("a", "")
+	p.Set("b", "value")
+	p.Set("c", "")
+	empty := func(key, value string) bool { return value == "" }
+	found := map[string]bool{}
+	p.RangeWhere(empty, func(key, value string) bool {
+		found[key] = true
+		return true
+	})
+	if len(found) != 2 || !found["a"] || !found["c"] {
+		t.Error("RangeWhere() visited ", found)
+	}
+	count := 0
+	p.RangeWhere(empty, func(key, value string) bool {
+		count += 1
+		return false
+	})
+	if count != 1 {
+		t.Error("RangeWhere() didn't stop, count is ", count)
+	}
+	count = 0
+	p.RangeWhere(nil, func(key, value string) bool {
+		count += 1
+		return true
+	})
+	if count != 3 {
+		t.Error("RangeWhere() with nil pred visited ", count)
+	}
+}
+
+func TestInlineComment(t *testing.T) {
+	p := NewTable()
+	opts := LoadOptions{InlineComments: true}
+	_, e := p.LoadWith(strings.NewReader("port = 8080 # default\nurl=http://host/#top\nhex=\\#fff ! color\n"), opts)
+	if e != nil {
+		t.Fatal("LoadWith() returned ", e)
+	}
+	if p.Get("port") != "8080" || p.InlineComment("port") != "default" {
+		t.Error(`port is `, p.Get("port"), p.InlineComment("port"))
+	}
+	if p.Get("url") != "http://host/#top" || p.InlineComment("url") != "" {
+		t.Error(`url is `, p.Get("url"), p.InlineComment("url"))
+	}
+	if p.Get("hex") != "#fff" || p.InlineComment("hex") != "color" {
+		t.Error(`hex is `, p.Get("hex"), p.InlineComment("hex"))
+	}
+	q := NewTable()
+	q.Set("padded", "value  ")
+	q.SetInlineComment("padded", " two\nlines ")
+	q.Set("blank", " ")
+	q.SetInlineComment("blank", `C:\temp é`)
+	q.Set("plain", "# not a comment")
+	for _, ascii := range []bool{false, true} {
+		var b strings.Builder
+		q.Store(&b, ascii)
+		r := NewTable()
+		r.LoadWith(strings.NewReader(b.String()), opts)
+		for _, key := range []string{"padded", "blank", "plain"} {
+			if r.Get(key) != q.Get(key) || r.InlineComment(key) != q.InlineComment(key) {
+				t.Errorf("%q didn't round-trip: %q", key, b.String())
+			}
+		}
+	}
+	if q.InlineComment("padded") != "two lines" {
+		t.Error(`q.InlineComment("padded") returned `, q.InlineComment("padded"))
+	}
+	q.SetInlineComment("padded", "")
+	q.Delete("blank")
+	if q.InlineComment("padded") != "" || q.InlineComment("blank") != "" {
+		t.Error("the inline comments weren't removed")
+	}
+}
+
+func TestHasAnyHasAll(t *testing.T) {
+	d := NewTable()
+	d.Set("b", "2")
+	p := NewTableWith(d)
+	p.Set("a", "1")
+	if !p.HasAny("x", "b") || p.HasAny("x", "y") || p.HasAny() {
+		t.Error("HasAny() failed")
+	}
+	if !p.HasAll("a", "b") || p.HasAll("a", "x") || !p.HasAll() {
+		t.Error("HasAll() failed")
+	}
+}
+
+func TestLoadCanonical(t *testing.T) {
+	p := NewTable()
+	p.Set("b", "\u00e9t\u00e9")
+	p.Set("a key", " = #1")
+	q, e := LoadCanonical(p.Canonical())
+	if e != nil || q.Get("a key") != " = #1" || q.Get("b") != "\u00e9t\u00e9" {
+		t.Error("LoadCanonical() returned ", q, e)
+	}
+	if q, e := LoadCanonical(nil); e != nil || q.String() != "" {
+		t.Error("LoadCanonical(nil) returned ", q, e)
+	}
+	for _, s := range []string{
+		"b=1\na=2\n",
+		"a=1\na=1\n",
+		"a:1\n",
+		"a = 1\n",
+		"a=\u00e9\n",
+		"a=\\u00E9\n",
+		"# comment\na=1\n",
+		"a=1\n\n",
+		"a=1",
+		"a=1\r\n",
+	} {
+		if q, e := LoadCanonical([]byte(s)); q != nil || !errors.Is(e, ErrNotCanonical) {
+			t.Errorf("LoadCanonical(%q) returned %v", s, e)
+		}
+	}
+	if _, e := LoadCanonical([]byte("a=1\nc=3\nb=2\n")); e.Error() != "properties: line 2: not in canonical form" {
+		t.Error("LoadCanonical() returned ", e)
+	}
+	p = FromMap(map[string]string{
+		`C:\temp`:       `C:\temp\new\`,
+		`\u0009`:        "\t",
+		"#hash":         "!bang #tag",
+		"a=b":           "=c:d",
+		"  lead":        "  lead ",
+		"\u00e9t\u00e9": "\u4e2d\u6587 \U0001F600",
+	})
+	q, e = LoadCanonical(p.Canonical())
+	if e != nil {
+		t.Fatal("LoadCanonical() returned ", e)
+	}
+	if !q.Equal(p) {
+		t.Errorf("LoadCanonical() loaded %q", q.String())
+	}
+}
+
+func TestGetIndexed(t *testing.T) {
+	d := NewTable()
+	d.Set("server.0.port", "80")
+	p := NewTableWith(d)
+	p.Set("server.0.host", "a.example.com")
+	p.Set("server.1.host", "b.example.com")
+	p.Set("server.1.port", "8080")
+	p.Set("server.3.host", "after.gap")
+	p.Set("server.01.host", "leading.zero")
+	p.Set("server.2", "no.name")
+	p.Set("servers", "other")
+	s := p.GetIndexed("server.")
+	if len(s) != 2 {
+		t.Fatal(`p.GetIndexed("server.") returned `, s)
+	}
+	if s[0].Get("host") != "a.example.com" || s[0].Get("port") != "80" {
+		t.Error("s[0] is ", s[0])
+	}
+	if s[1].Get("host") != "b.example.com" || s[1].Get("port") != "8080" {
+		t.Error("s[1] is ", s[1])
+	}
+	if s := p.GetIndexed("client."); len(s) != 0 {
+		t.Error(`p.GetIndexed("client.") returned `, s)
+	}
+}
+
+func TestIntern(t *testing.T) {
+	d := NewTable()
+	d.LoadString("a=shared\nb=other\n")
+	p := NewTableWith(d)
+	p.LoadString("c=shared\nd=shared\ne=other\n")
+	p.Store(io.Discard, false)
+	p.Intern()
+	if p.Get("a") != "shared" || p.Get("b") != "other" || p.Get("c") != "shared" ||
+		p.Get("d") != "shared" || p.Get("e") != "other" {
+		t.Error("Intern() changed the values: ", p, d)
+	}
+	if unsafe.StringData(p.Get("c")) != unsafe.StringData(p.Get("d")) {
+		t.Error("Intern() didn't share the values of the primary table")
+	}
+	if unsafe.StringData(p.Get("a")) != unsafe.StringData(p.Get("c")) ||
+		unsafe.StringData(p.Get("b")) != unsafe.StringData(p.Get("e")) {
+		t.Error("Intern() didn't share the values with the secondary table")
+	}
+	if p.Dirty() {
+		t.Error("Intern() marked the table")
+	}
+}
+
+// BenchmarkIntern reports the heap used by a table holding many copies of a
+// few values, as loaded and once interned.
+func BenchmarkIntern(b *testing.B) {
+	var s strings.Builder
+	for i := 0; i < 10000; i++ {
+		s.WriteString("key" + strconv.Itoa(i) + "=")
+		s.WriteString(strings.Repeat("value"+strconv.Itoa(i%10)+" ", 10) + "\n")
+	}
+	input := s.String()
+	for _, intern := range []bool{false, true} {
+		name := "Loaded"
+		if intern {
+			name = "Interned"
+		}
+		b.Run(name, func(b *testing.B) {
+			var before, after runtime.MemStats
+			var heap int64
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				runtime.ReadMemStats(&before)
+				p := NewTable()
+				p.LoadString(input)
+				if intern {
+					p.Intern()
+				}
+				runtime.GC()
+				runtime.ReadMemStats(&after)
+				heap += int64(after.HeapAlloc) - int64(before.HeapAlloc)
+				runtime.KeepAlive(p)
+			}
+			b.ReportMetric(float64(heap)/float64(b.N), "heap-B/op")
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	d := NewTable()
+	d.Set("default", "1")
+	p := NewTableWith(d)
+	if keys := p.Keys(); len(keys) != 0 {
+		t.Error("Keys() returned ", keys)
+	}
+	p.Set("b", "2")
+	p.Set("a", "1")
+	keys := p.Keys()
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Error("Keys() returned ", keys)
+	}
+	keys[0] = "changed"
+	if p.Get("a") != "1" || p.Keys()[0] != "a" {
+		t.Error("modifying the keys changed the table")
+	}
+}
+
+func TestLen(t *testing.T) {
+	p := NewTable()
+	if p.Len() != 0 || p.LenAll() != 0 {
+		t.Error("Len() of a new table returned ", p.Len(), p.LenAll())
+	}
+	p.Set("a", "1")
+	p.SetFallback("f", "0")
+	if p.Len() != 1 || p.LenAll() != 2 {
+		t.Error("Len() returned ", p.Len(), p.LenAll())
+	}
+	d := NewTable()
+	d.Set("a", "default")
+	d.Set("b", "2")
+	q := NewTableWith(d)
+	q.Set("a", "1")
+	q.Set("c", "3")
+	if q.Len() != 2 || q.LenAll() != 3 {
+		t.Error("Len() returned ", q.Len(), q.LenAll())
+	}
+}
+
+func TestContains(t *testing.T) {
+	d := NewTable()
+	d.Set("default", "")
+	p := NewTableWith(d)
+	p.Set("empty", "")
+	p.SetFallback("fallback", "1")
+	if !p.Contains("empty") || !p.Contains("default") || !p.Contains("fallback") || p.Contains("missing") {
+		t.Error("Contains() failed")
+	}
+	if !p.ContainsLocal("empty") || p.ContainsLocal("default") || p.ContainsLocal("fallback") {
+		t.Error("ContainsLocal() failed")
+	}
+}
+
+func TestGetOr(t *testing.T) {
+	d := NewTable()
+	d.Set("default", "1")
+	p := NewTableWith(d)
+	p.Set("empty", "")
+	if s := p.GetOr("default", "x"); s != "1" {
+		t.Error(`p.GetOr("default", "x") returned `, s)
+	}
+	if s := p.GetOr("empty", "x"); s != "" {
+		t.Error(`p.GetOr("empty", "x") returned `, s)
+	}
+	if s := p.GetOr("missing", "x"); s != "x" {
+		t.Error(`p.GetOr("missing", "x") returned `, s)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	d := NewTable()
+	d.Set("default", "other")
+	other := NewTableWith(d)
+	other.Set("a", "other")
+	other.Set("b", "other")
+	p := NewTable()
+	p.Set("a", "p")
+	p.Set("c", "p")
+	p.Merge(other)
+	if p.Get("a") != "other" || p.Get("b") != "other" || p.Get("c") != "p" || p.Contains("default") {
+		t.Error("Merge() failed: ", p)
+	}
+	if other.Len() != 2 || other.Get("a") != "other" {
+		t.Error("Merge() modified other: ", other)
+	}
+	q := NewTable()
+	q.Set("a", "q")
+	q.MergeKeeping(other)
+	if q.Get("a") != "q" || q.Get("b") != "other" || q.Contains("default") {
+		t.Error("MergeKeeping() failed: ", q)
+	}
+}
+
+func TestClone(t *testing.T) {
+	d := NewTable()
+	d.Set("default", "base")
+	p := NewTableWith(d)
+	p.Set("key", "value")
+	p.SetFallback("fallback", "1")
+	p.SetInlineComment("key", "comment")
+	c := p.Clone()
+	if c.Get("key") != "value" || c.Get("default") != "base" || c.Get("fallback") != "1" ||
+		c.InlineComment("key") != "comment" {
+		t.Error("Clone() returned ", c)
+	}
+	c.Set("key", "changed")
+	c.Set("new", "added")
+	c.SetInlineComment("key", "")
+	c.defaults.Set("default", "changed")
+	if p.Get("key") != "value" || p.Contains("new") || p.Get("default") != "base" ||
+		p.InlineComment("key") != "comment" {
+		t.Error("modifying the clone changed the original: ", p, d)
+	}
+	c.ClearAll()
+	if p.Get("key") != "value" || d.Get("default") != "base" {
+		t.Error("clearing the clone changed the original: ", p, d)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	p := NewTable()
+	p.Set("a", "1")
+	p.Set("b", "2")
+	q := NewTableWith(NewTable())
+	q.Set("b", "2")
+	q.Set("a", "1")
+	if !p.Equal(q) || !p.EqualResolved(q) {
+		t.Error("equal tables compare different")
+	}
+	q.Set("b", "")
+	if p.Equal(q) || p.EqualResolved(q) {
+		t.Error("different values compare equal")
+	}
+	d := NewTable()
+	d.Set("b", "2")
+	d.Set("a", "default")
+	r := NewTableWith(d)
+	r.Set("a", "1")
+	if p.Equal(r) || !p.EqualResolved(r) || !r.EqualResolved(p) {
+		t.Error("EqualResolved() failed")
+	}
+	r.Set("c", "3")
+	if r.EqualResolved(p) {
+		t.Error("EqualResolved() ignored an extra key")
+	}
+}
+
+func TestStoreSorted(t *testing.T) {
+	p := NewTable()
+	p.Set("b", "2")
+	p.Set("c", "3")
+	p.Set("a", "1")
+	p.Set("a.b", "4")
+	want := "a=1\na.b=4\nb=2\nc=3\n"
+	var b strings.Builder
+	if _, e := p.Store(&b, false); e != nil || b.String() != want {
+		t.Error("Store() wrote ", b.String(), e)
+	}
+	if s := p.String(); s != want {
+		t.Error("String() returned ", s)
+	}
+	if s, e := p.SaveString("header", false); e != nil || s != "#header\n"+want {
+		t.Error("SaveString() returned ", s, e)
+	}
+}
+
+func TestPropertyNames(t *testing.T) {
+	b := NewTable()
+	b.Set("c", "base")
+	b.Set("a", "base")
+	d := NewTableWith(b)
+	d.Set("b", "default")
+	p := NewTableWith(d)
+	p.Set("a", "1")
+	p.SetFallback("f", "0")
+	names := p.PropertyNames()
+	if !slices.Equal(names, []string{"a", "b", "c", "f"}) {
+		t.Error("PropertyNames() returned ", names)
+	}
+	if names := NewTable().PropertyNames(); len(names) != 0 {
+		t.Error("PropertyNames() of a new table returned ", names)
+	}
+}
+
+func TestSetDefaults(t *testing.T) {
+	p := NewTable()
+	if p.Defaults() != nil {
+		t.Error("Defaults() of a new table returned ", p.Defaults())
+	}
+	d := NewTable()
+	d.Set("key", "default")
+	p.SetDefaults(d)
+	q := NewTableWith(d)
+	if p.Defaults() != d || p.Get("key") != "default" {
+		t.Error("SetDefaults() didn't set the defaults")
+	}
+	d.Set("key", "shared")
+	if p.Get("key") != "shared" || q.Get("key") != "shared" {
+		t.Error("SetDefaults() copied the defaults")
+	}
+	p.SetDefaults(nil)
+	if p.Defaults() != nil || p.Contains("key") {
+		t.Error("SetDefaults(nil) didn't remove the defaults")
+	}
+}
+
+func TestToMap(t *testing.T) {
+	d := NewTable()
+	d.Set("a", "default")
+	d.Set("b", "2")
+	p := NewTableWith(d)
+	p.Set("a", "1")
+	p.SetFallback("c", "3")
+	m := p.ToMap()
+	if len(m) != 1 || m["a"] != "1" {
+		t.Error("ToMap() returned ", m)
+	}
+	m["a"] = "changed"
+	if p.Get("a") != "1" {
+		t.Error("modifying the map changed the table")
+	}
+	m = p.ToMapResolved()
+	if len(m) != 3 || m["a"] != "1" || m["b"] != "2" || m["c"] != "3" {
+		t.Error("ToMapResolved() returned ", m)
+	}
+	m["b"] = "changed"
+	if d.Get("b") != "2" {
+		t.Error("modifying the map changed the defaults")
+	}
+}
+
+func TestSetAll(t *testing.T) {
+	m := map[string]string{"a": "1", "b": "2"}
+	p := FromMap(m)
+	if !p.Equal(FromMap(map[string]string{"b": "2", "a": "1"})) || p.Defaults() != nil {
+		t.Error("FromMap() returned ", p)
+	}
+	m["a"] = "changed"
+	if p.Get("a") != "1" {
+		t.Error("modifying the map changed the table")
+	}
+	p.SetAll(map[string]string{"b": "3", "c": "4"})
+	if p.Len() != 3 || p.Get("a") != "1" || p.Get("b") != "3" || p.Get("c") != "4" {
+		t.Error("SetAll() failed: ", p)
+	}
+}
+
+func TestStoreDelimiter(t *testing.T) {
+	p := NewTable()
+	p.Set("a:b", "=1")
+	p.Set("c d", "2 = 3")
+	p.SetInlineComment("c d", "note")
+	p.Set("", "v")
+	for _, delim := range []string{"", "=", ":", " = ", " : ", " ", "\t"} {
+		var b strings.Builder
+		if _, e := p.StoreWith(&b, StoreOptions{Delimiter: delim}); e != nil {
+			t.Errorf("StoreWith(%q) returned %v", delim, e)
+		}
+		if delim == " = " && b.String() != " = v\na\\:b = \\=1\nc\\ d = 2 = 3 # note\n" {
+			t.Errorf("StoreWith(%q) wrote %q", delim, b.String())
+		}
+		q := NewTable()
+		q.LoadString(b.String())
+		if q.Get("a:b") != "=1" || q.Get("c d") != "2 = 3 # note" || q.Get("") != "v" || q.Len() != 3 {
+			t.Errorf("StoreWith(%q) wrote %q", delim, b.String())
+		}
+		if delim == " " && !strings.HasPrefix(b.String(), "=v\n") {
+			t.Errorf("StoreWith(%q) wrote %q", delim, b.String())
+		}
+	}
+	for _, delim := range []string{"->", "==", "= :", "#"} {
+		var b strings.Builder
+		if _, e := p.StoreWith(&b, StoreOptions{Delimiter: delim}); !errors.Is(e, ErrDelimiter) || b.Len() != 0 {
+			t.Errorf("StoreWith(%q) returned %v", delim, e)
+		}
+	}
+}
+
+func TestStoreLineSeparator(t *testing.T) {
+	p := NewTable()
+	p.Set("a", "line\nbreak\r\n")
+	p.Set("b", "2")
+	opts := StoreOptions{Header: "one\ntwo\r\nthree", Footer: "end", LineSeparator: "\r\n", BlankBetween: true}
+	var b strings.Builder
+	if _, e := p.StoreWith(&b, opts); e != nil {
+		t.Error("StoreWith() returned ", e)
+	}
+	want := "#one\r\n#two\r\n#three\r\na=line\\nbreak\\r\\n\r\n\r\nb=2\r\n#end\r\n"
+	if b.String() != want {
+		t.Errorf("StoreWith() wrote %q", b.String())
+	}
+	q := NewTable()
+	q.LoadString(b.String())
+	if !q.Equal(p) {
+		t.Error("LoadString() returned ", q)
+	}
+	b.Reset()
+	opts.LineSeparator = "\r"
+	p.StoreWith(&b, opts)
+	if !strings.HasPrefix(b.String(), "#one\r#two\r#three\ra=") {
+		t.Errorf("StoreWith() wrote %q", b.String())
+	}
+	b.Reset()
+	opts.LineSeparator = "\n\r"
+	if _, e := p.StoreWith(&b, opts); !errors.Is(e, ErrLineSeparator) || b.Len() != 0 {
+		t.Error("StoreWith() returned ", e)
+	}
+}
+
+func TestSetOrdered(t *testing.T) {
+	p := NewTable()
+	p.Set("z", "0")
+	p.Set("y", "0")
+	p.SetOrdered(true)
+	if !p.Ordered() {
+		t.Error("Ordered() returned false")
+	}
+	p.LoadString("c=1\na=2\nb=3\n")
+	p.Set("a", "4")
+	p.Delete("z")
+	p.Set("z", "5")
+	if s := p.String(); s != "y=0\nc=1\na=4\nb=3\nz=5\n" {
+		t.Errorf("String() returned %q", s)
+	}
+	c := p.Clone()
+	c.Set("d", "6")
+	var b strings.Builder
+	c.Store(&b, false)
+	if b.String() != "y=0\nc=1\na=4\nb=3\nz=5\nd=6\n" {
+		t.Errorf("Store() wrote %q", b.String())
+	}
+	if s := string(p.Canonical()); s != "a=4\nb=3\nc=1\ny=0\nz=5\n" {
+		t.Errorf("Canonical() returned %q", s)
+	}
+	q := NewTable()
+	q.SetOrdered(true)
+	q.Merge(p)
+	if s := q.String(); s != p.String() {
+		t.Errorf("Merge() kept the order %q", s)
+	}
+	p.Clear()
+	p.Set("b", "1")
+	p.Set("a", "2")
+	if s := p.String(); s != "b=1\na=2\n" || !p.Ordered() {
+		t.Errorf("String() after Clear() returned %q", s)
+	}
+	p.SetOrdered(false)
+	if s := p.String(); s != "a=2\nb=1\n" || p.Ordered() {
+		t.Errorf("String() returned %q", s)
+	}
+}
+
+func TestLoadStrictDuplicates(t *testing.T) {
+	input := "# settings\nport=1\nhost=a\nport=\\\n  2\nport=3\n"
+	p := NewTable()
+	n, e := p.LoadWith(strings.NewReader(input), LoadOptions{})
+	if n != 4 || e != nil || p.Get("port") != "3" {
+		t.Error("LoadWith() returned ", n, e)
+	}
+	n, e = p.LoadWith(strings.NewReader(input), LoadOptions{Strict: true})
+	var errs ErrorList
+	if n != 4 || !errors.As(e, &errs) || len(errs) != 2 || !errors.Is(e, ErrDuplicateKey) {
+		t.Fatal("LoadWith() returned ", n, e)
+	}
+	var le *LineError
+	if !errors.As(errs[1], &le) || le.Line != 6 || le.Key != "port" {
+		t.Error("errs[1] is ", errs[1])
+	}
+	if errs[0].Error() != `properties: line 4: "port": duplicate key` {
+		t.Error("errs[0] is ", errs[0])
+	}
+	if p.Get("port") != "3" {
+		t.Error(`p.Get("port") returned `, p.Get("port"))
+	}
+}
+
+func TestLoadBOM(t *testing.T) {
+	p := NewTable()
+	if n, e := p.Load(strings.NewReader("\ufefffoo=bar\n\ufeffbaz=qux")); n != 2 || e != nil {
+		t.Error("p.Load(...) returned ", n, e)
+	}
+	if s := p.Get("foo"); s != "bar" {
+		t.Error(`p.Get("foo") returned `, s)
+	}
+	if s := p.Get("\ufeffbaz"); s != "qux" {
+		t.Error(`p.Get("\ufeffbaz") returned `, s)
+	}
+	var b strings.Builder
+	if n, e := Filter(strings.NewReader("\ufefffoo=bar"), &b, nil, false); n != 1 || e != nil || b.String() != "foo=bar\n" {
+		t.Errorf("Filter(...) returned %d, %v, wrote %q", n, e, b.String())
+	}
+}
+
+func TestLoadOctal(t *testing.T) {
+	input := `a=\0
+b=\101\102C
+c=\1234
+d=\08
+e=xA\7
+`
+	p := NewTable()
+	if n, e := p.LoadWith(strings.NewReader(input), LoadOptions{Octal: true}); n != 5 || e != nil {
+		t.Fatal("p.LoadWith(...) returned ", n, e)
+	}
+	want := map[string]string{"a": "\x00", "b": "ABC", "c": "S4", "d": "\x008", "e": "xA\a"}
+	for key, value := range want {
+		if s := p.Get(key); s != value {
+			t.Errorf("p.Get(%q) returned %q", key, s)
+		}
+	}
+	q := NewTable()
+	q.Load(strings.NewReader(input))
+	if s := q.Get("b"); s != "101102C" {
+		t.Errorf(`q.Get("b") returned %q`, s)
+	}
+}
+
+func TestBackspace(t *testing.T) {
+	p := NewTable()
+	p.LoadWith(strings.NewReader(`a=x\by`), LoadOptions{Backspace: true})
+	if s := p.Get("a"); s != "x\by" {
+		t.Errorf(`p.Get("a") returned %q`, s)
+	}
+	q := NewTable()
+	q.Load(strings.NewReader(`a=x\by`))
+	if s := q.Get("a"); s != "xby" {
+		t.Errorf(`q.Get("a") returned %q`, s)
+	}
+	p.Set("k\b", "\b\u00e9")
+	for _, mode := range []EscapeMode{EscapeNone, EscapeASCII} {
+		var b strings.Builder
+		p.StoreWith(&b, StoreOptions{Escape: mode, Backspace: true})
+		want := "a=x\\by\nk\\b=\\b\u00e9\n"
+		if mode == EscapeASCII {
+			want = "a=x\\by\nk\\b=\\b\\u00e9\n"
+		}
+		if b.String() != want {
+			t.Errorf("p.StoreWith(...) wrote %q", b.String())
+		}
+	}
+	var b strings.Builder
+	p.StoreWith(&b, StoreOptions{Escape: EscapeASCII})
+	if b.String() != "a=x\\u0008y\nk\\u0008=\\u0008\\u00e9\n" {
+		t.Errorf("p.StoreWith(...) wrote %q", b.String())
+	}
+}
+
+func TestUpperHex(t *testing.T) {
+	p := NewTable()
+	p.Set("price", "5 €")
+	for _, upper := range []bool{false, true} {
+		var b strings.Builder
+		p.StoreWith(&b, StoreOptions{Escape: EscapeASCII, UpperHex: upper, Header: "€"})
+		want := "#\\u20ac\nprice=5 \\u20ac\n"
+		if upper {
+			want = "#\\u20AC\nprice=5 \\u20AC\n"
+		}
+		if b.String() != want {
+			t.Errorf("p.StoreWith(...) wrote %q", b.String())
+		}
+		q := NewTable()
+		q.Load(strings.NewReader(b.String()))
+		if !q.Equal(p) {
+			t.Errorf("the output of p.StoreWith(...) loaded as %q", q.String())
+		}
+	}
+}
+
+func TestSub(t *testing.T) {
+	d := NewTable()
+	d.Set("db.host", "localhost")
+	d.Set("db.port", "5432")
+	p := NewTableWith(d)
+	p.Set("db.host", "example.com")
+	p.Set("cache.ttl", "60")
+	p.SetFallback("db.user", "admin")
+	s := p.Sub("db.")
+	if s.String() != "host=example.com\nport=5432\nuser=admin\n" {
+		t.Errorf(`p.Sub("db.") returned %q`, s.String())
+	}
+	if s.Defaults() != nil {
+		t.Error(`p.Sub("db.") has defaults`)
+	}
+	s.Set("host", "changed")
+	if v := p.Get("db.host"); v != "example.com" {
+		t.Error(`p.Get("db.host") returned `, v)
+	}
+	if s := p.Sub(""); s.Len() != 4 || s.Get("db.port") != "5432" || s.Get("db.user") != "admin" {
+		t.Errorf(`p.Sub("") returned %q`, s.String())
+	}
+	if s := p.Sub("none."); s.Len() != 0 {
+		t.Errorf(`p.Sub("none.") returned %q`, s.String())
+	}
+}
+
+func TestRename(t *testing.T) {
+	d := NewTable()
+	d.Set("legacy", "default")
+	p := NewTableWith(d)
+	p.Set("db.hostname", "example.com")
+	p.SetInlineComment("db.hostname", "production")
+	p.Set("db.host", "localhost")
+	if !p.Rename("db.hostname", "db.host") {
+		t.Error(`p.Rename("db.hostname", "db.host") returned false`)
+	}
+	if s, found := p.Lookup("db.hostname"); found {
+		t.Error(`p.Lookup("db.hostname") returned `, s)
+	}
+	if s := p.Get("db.host"); s != "example.com" {
+		t.Error(`p.Get("db.host") returned `, s)
+	}
+	if s := p.InlineComment("db.host"); s != "production" {
+		t.Error(`p.InlineComment("db.host") returned `, s)
+	}
+	if p.Rename("legacy", "current") {
+		t.Error(`p.Rename("legacy", "current") returned true`)
+	}
+	if p.ContainsLocal("current") || d.Get("legacy") != "default" {
+		t.Error(`p.Rename("legacy", "current") modified the tables`)
+	}
+	if !p.Rename("db.host", "db.host") || p.Get("db.host") != "example.com" {
+		t.Error(`p.Rename("db.host", "db.host") lost the value`)
+	}
+}
+
+func TestSetComment(t *testing.T) {
+	p := NewTable()
+	p.Set("host", "localhost")
+	p.Set("port", "8080")
+	p.Set("user", "admin")
+	p.SetComment("port", "The port to listen on.\r\nDefaults to 8080.\n! Keep it above 1024.")
+	p.SetComment("user", "The user name")
+	p.SetComment("user", "")
+	if s := p.Comment("port"); s != "The port to listen on.\r\nDefaults to 8080.\n! Keep it above 1024." {
+		t.Errorf(`p.Comment("port") returned %q`, s)
+	}
+	want := "host=localhost\n#The port to listen on.\n#Defaults to 8080.\n! Keep it above 1024.\nport=8080\nuser=admin\n"
+	var b strings.Builder
+	if p.Store(&b, false); b.String() != want {
+		t.Errorf("p.Store(...) wrote %q", b.String())
+	}
+	b.Reset()
+	p.StoreWith(&b, StoreOptions{LineSeparator: "\r\n", BlankBetween: true})
+	want = "host=localhost\r\n\r\n#The port to listen on.\r\n#Defaults to 8080.\r\n! Keep it above 1024.\r\nport=8080\r\n\r\nuser=admin\r\n"
+	if b.String() != want {
+		t.Errorf("p.StoreWith(...) wrote %q", b.String())
+	}
+	q := NewTable()
+	q.LoadString(want)
+	if !q.Equal(p) {
+		t.Errorf("the output of p.StoreWith(...) loaded as %q", q.String())
+	}
+	p.Rename("port", "http.port")
+	if p.Comment("port") != "" || p.Comment("http.port") == "" {
+		t.Error(`p.Rename("port", "http.port") didn't move the comment`)
+	}
+	p.Delete("http.port")
+	p.Set("http.port", "80")
+	if s := p.Comment("http.port"); s != "" {
+		t.Errorf(`p.Comment("http.port") returned %q`, s)
+	}
+}
+
+func TestStoreTimestamp(t *testing.T) {
+	p := NewTable()
+	p.Set("key", "value")
+	now := func() time.Time {
+		return time.Date(2024, time.March, 1, 12, 30, 0, 0, time.UTC)
+	}
+	var b strings.Builder
+	p.StoreWith(&b, StoreOptions{Header: "Settings", Timestamp: true, Now: now, LineSeparator: "\r\n"})
+	if b.String() != "#Settings\r\n#Fri, 01 Mar 2024 12:30:00 UTC\r\nkey=value\r\n" {
+		t.Errorf("p.StoreWith(...) wrote %q", b.String())
+	}
+	b.Reset()
+	p.StoreWith(&b, StoreOptions{Timestamp: true})
+	if s := b.String(); !strings.HasPrefix(s, "#") || !strings.HasSuffix(s, "\nkey=value\n") {
+		t.Errorf("p.StoreWith(...) wrote %q", s)
+	} else if _, e := time.Parse(time.RFC1123, s[1:strings.IndexByte(s, '\n')]); e != nil {
+		t.Error("the timestamp can't be parsed: ", e)
+	}
+	b.Reset()
+	p.StoreWith(&b, StoreOptions{Now: now})
+	if b.String() != "key=value\n" {
+		t.Errorf("p.StoreWith(...) wrote %q", b.String())
+	}
+}
+
+// cancelReader cancels its context once the given number of bytes is read.
+type cancelReader struct {
+	r      io.Reader
+	n      int
+	cancel context.CancelFunc
+}
+
+func (c *cancelReader) Read(b []byte) (int, error) {
+	if len(b) > 1 {
+		b = b[:1]
+	}
+	n, e := c.r.Read(b)
+	if c.n -= n; c.n <= 0 {
+		c.cancel()
+	}
+	return n, e
+}
+
+func TestLoadContext(t *testing.T) {
+	input := "a=1\nb=2\nc=3\nd=4\n"
+	p := NewTable()
+	if n, e := p.LoadContext(context.Background(), strings.NewReader(input)); n != 4 || e != nil {
+		t.Error("p.LoadContext(...) returned ", n, e)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := NewTable()
+	n, e := q.LoadContext(ctx, &cancelReader{strings.NewReader(input), 8, cancel})
+	if !errors.Is(e, context.Canceled) || n < 1 || n >= 4 || q.Len() != n {
+		t.Error("q.LoadContext(...) returned ", n, e)
+	}
+	if s := q.Get("a"); s != "1" {
+		t.Error(`q.Get("a") returned `, s)
+	}
+}
+
+func TestLoadLargeInput(t *testing.T) {
+	var b strings.Builder
+	want := make(map[string]string)
+	for i := 0; b.Len() < 3*4096; i++ {
+		key := "key" + strconv.Itoa(i)
+		value := strings.Repeat("v", i%61)
+		want[key] = value + "end"
+		b.WriteString(key + " = " + value + "\\\r\n    end\r\n")
+	}
+	p := NewTable()
+	n, e := p.Load(strings.NewReader(b.String()))
+	if n != len(want) || e != nil {
+		t.Fatal("p.Load(...) returned ", n, e)
+	}
+	for key, value := range want {
+		if s := p.Get(key); s != value {
+			t.Errorf("p.Get(%q) returned %q", key, s)
+		}
+	}
+}
+
+func TestEmptyKey(t *testing.T) {
+	p := NewTable()
+	p.Set("", "root value")
+	p.Set("a", "1")
+	var b strings.Builder
+	p.Store(&b, false)
+	s := b.String()
+	if s != "=root value\na=1\n" {
+		t.Errorf("p.Store(...) wrote %q", s)
+	}
+	q := NewTable()
+	if n, e := q.LoadString(s); n != 2 || e != nil {
+		t.Error("q.LoadString(...) returned ", n, e)
+	}
+	if v, found := q.Lookup(""); !found || v != "root value" {
+		t.Error(`q.Lookup("") returned `, v, found)
+	}
+	if !q.Equal(p) {
+		t.Errorf("the output of p.Store(...) loaded as %q", q.String())
+	}
+	q.Clear()
+	q.LoadString("=\n:\n")
+	if v, found := q.Lookup(""); !found || v != "" || q.Len() != 1 {
+		t.Error(`q.Lookup("") returned `, v, found)
+	}
+}
+
+func TestSaveEmptyComments(t *testing.T) {
+	p := NewTable()
+	p.Set("key", "value")
+	for _, comments := range []string{"", " ", "\n", " \r\n\t"} {
+		if s, e := p.SaveString(comments, false); s != "key=value\n" || e != nil {
+			t.Errorf("p.SaveString(%q, false) returned %q, %v", comments, s, e)
+		}
+	}
+	if s, _ := p.SaveString("Settings", false); s != "#Settings\nkey=value\n" {
+		t.Errorf(`p.SaveString("Settings", false) returned %q`, s)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	staging := NewTable()
+	staging.LoadString("host=staging\nport=80\ndebug=true\nname=app\ntrace=on\n")
+	prod := NewTableWith(staging)
+	prod.LoadString("host=prod\nport=80\nname=application\nreplicas=3\nzone=eu\n")
+	added, removed, changed := staging.Diff(prod)
+	if !slices.Equal(added, []string{"replicas", "zone"}) {
+		t.Error("Diff() returned added ", added)
+	}
+	if !slices.Equal(removed, []string{"debug", "trace"}) {
+		t.Error("Diff() returned removed ", removed)
+	}
+	if !slices.Equal(changed, []string{"host", "name"}) {
+		t.Error("Diff() returned changed ", changed)
+	}
+	added, removed, changed = prod.Diff(prod.Clone())
+	if added == nil || len(added)+len(removed)+len(changed) != 0 {
+		t.Error("Diff() returned ", added, removed, changed)
+	}
+}
+
+func TestFilterMethod(t *testing.T) {
+	d := NewTable()
+	d.Set("db.user", "admin")
+	p := NewTableWith(d)
+	p.SetOrdered(true)
+	p.Set("db.port", "5432")
+	p.Set("cache.ttl", "60")
+	p.Set("db.host", "")
+	f := p.Filter(func(key, value string) bool {
+		return strings.HasPrefix(key, "db.") && value != ""
+	})
+	if f.String() != "db.port=5432\n" || f.Defaults() != nil {
+		t.Errorf("p.Filter(...) returned %q", f.String())
+	}
+	f = p.Filter(func(key, value string) bool { return true })
+	if f.String() != "db.port=5432\ncache.ttl=60\ndb.host=\n" || !f.Ordered() {
+		t.Errorf("p.Filter(...) returned %q", f.String())
+	}
+	f.Delete("db.port")
+	if p.Len() != 3 || p.Get("db.port") != "5432" {
+		t.Errorf("p.Filter(...) modified p to %q", p.String())
+	}
+}
+
+func TestValues(t *testing.T) {
+	d := NewTable()
+	d.Set("default", "1")
+	p := NewTableWith(d)
+	if values := p.Values(); len(values) != 0 {
+		t.Error("Values() returned ", values)
+	}
+	p.Set("b", "2")
+	p.Set("a", "1")
+	p.Set("c", "")
+	values := p.Values()
+	if len(values) != 3 || values[0] != "1" || values[1] != "2" || values[2] != "" {
+		t.Error("Values() returned ", values)
+	}
+	values[0] = "changed"
+	if p.Get("a") != "1" {
+		t.Error("modifying the values changed the table")
+	}
+}
+
+func TestIsEmpty(t *testing.T) {
+	d := NewTable()
+	p := NewTableWith(d)
+	if !p.IsEmpty() || !p.IsEmptyResolved() {
+		t.Error("IsEmpty() of an empty table returned ", p.IsEmpty(), p.IsEmptyResolved())
+	}
+	d.SetFallback("a", "fallback")
+	if !p.IsEmpty() || p.IsEmptyResolved() {
+		t.Error("IsEmpty() with fallback values returned ", p.IsEmpty(), p.IsEmptyResolved())
+	}
+	d = NewTable()
+	p.SetDefaults(d)
+	d.Set("b", "2")
+	if !p.IsEmpty() || p.IsEmptyResolved() {
+		t.Error("IsEmpty() with defaults returned ", p.IsEmpty(), p.IsEmptyResolved())
+	}
+	p.Set("c", "3")
+	d.Clear()
+	if p.IsEmpty() || p.IsEmptyResolved() {
+		t.Error("IsEmpty() returned ", p.IsEmpty(), p.IsEmptyResolved())
+	}
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	d := NewTable()
+	d.Set("port", "80")
+	p := NewTableWith(d)
+	p.Set("host", "example.com")
+	p.Set("empty", "")
+	if p.SetIfAbsent("host", "localhost") || p.Get("host") != "example.com" {
+		t.Error(`p.SetIfAbsent("host", ...) set `, p.Get("host"))
+	}
+	if p.SetIfAbsent("empty", "value") || p.Get("empty") != "" {
+		t.Error(`p.SetIfAbsent("empty", ...) set `, p.Get("empty"))
+	}
+	if !p.SetIfAbsent("port", "8080") || p.Get("port") != "8080" || d.Get("port") != "80" {
+		t.Error(`p.SetIfAbsent("port", ...) set `, p.Get("port"), d.Get("port"))
+	}
+	if !p.SetIfAbsent("user", "admin") || p.Len() != 4 {
+		t.Errorf(`p.SetIfAbsent("user", ...) left %q`, p.String())
+	}
+}
+
+func TestGetAndDelete(t *testing.T) {
+	d := NewTable()
+	d.Set("token", "default")
+	p := NewTableWith(d)
+	p.Set("token", "secret")
+	p.SetComment("token", "one-shot")
+	if s, found := p.GetAndDelete("token"); s != "secret" || !found {
+		t.Error(`p.GetAndDelete("token") returned `, s, found)
+	}
+	if p.ContainsLocal("token") || p.Comment("token") != "" || p.Get("token") != "default" {
+		t.Error(`p.GetAndDelete("token") left `, p.Get("token"))
+	}
+	if s, found := p.GetAndDelete("token"); s != "" || found || d.Get("token") != "default" {
+		t.Error(`p.GetAndDelete("token") returned `, s, found)
+	}
+}
+
+func TestDeletePrefix(t *testing.T) {
+	d := NewTable()
+	d.Set("db.user", "admin")
+	p := NewTableWith(d)
+	p.Set("db.host", "example.com")
+	p.Set("db.port", "5432")
+	p.Set("dbx", "1")
+	p.Set("cache.ttl", "60")
+	p.SetComment("db.host", "the server")
+	if n := p.DeletePrefix("db."); n != 2 || p.String() != "cache.ttl=60\ndbx=1\n" {
+		t.Errorf(`p.DeletePrefix("db.") returned %d, left %q`, n, p.String())
+	}
+	if p.Comment("db.host") != "" || d.Get("db.user") != "admin" {
+		t.Error(`p.DeletePrefix("db.") left `, p.Comment("db.host"), d.Get("db.user"))
+	}
+	if n := p.DeletePrefix("none."); n != 0 || p.Len() != 2 {
+		t.Error(`p.DeletePrefix("none.") returned `, n)
+	}
+	if n := p.DeletePrefix(""); n != 2 || p.Len() != 0 || d.Len() != 1 {
+		t.Error(`p.DeletePrefix("") returned `, n)
+	}
+}
+
+func TestDeleteFunc(t *testing.T) {
+	d := NewTable()
+	d.Set("empty", "")
+	p := NewTableWith(d)
+	p.Set("host", "")
+	p.Set("port", "5432")
+	p.Set("user", "")
+	n := p.DeleteFunc(func(key, value string) bool {
+		return value == ""
+	})
+	if n != 2 || p.String() != "port=5432\n" || d.Len() != 1 {
+		t.Errorf("p.DeleteFunc(...) returned %d, left %q", n, p.String())
+	}
+	n = p.DeleteFunc(func(key, value string) bool {
+		return false
+	})
+	if n != 0 || p.Len() != 1 {
+		t.Error("p.DeleteFunc(...) returned ", n)
+	}
+}
+
+func TestKeyValidator(t *testing.T) {
+	errInvalid := errors.New("invalid key")
+	p := NewTable()
+	if e := p.TrySet("a b", "1"); e != nil || p.Get("a b") != "1" {
+		t.Error(`p.TrySet("a b", "1") returned `, e)
+	}
+	p.SetKeyValidator(func(key string) error {
+		if key == "" || strings.ContainsAny(key, " =:") {
+			return errInvalid
+		}
+		return nil
+	})
+	if e := p.TrySet("db.host", "localhost"); e != nil || p.Get("db.host") != "localhost" {
+		t.Error(`p.TrySet("db.host", ...) returned `, e)
+	}
+	e := p.TrySet("db host", "localhost")
+	if !errors.Is(e, errInvalid) || p.Contains("db host") || e.Error() != `properties: "db host": invalid key` {
+		t.Error(`p.TrySet("db host", ...) returned `, e)
+	}
+	input := "port=80\nbad\\ key=1\nhost=example.com\n"
+	q := p.Clone()
+	n, e := q.LoadWith(strings.NewReader(input), LoadOptions{ValidateKeys: true})
+	var errs ErrorList
+	if n != 2 || !errors.As(e, &errs) || len(errs) != 1 || !errors.Is(e, errInvalid) {
+		t.Fatal("q.LoadWith(...) returned ", n, e)
+	}
+	if errs[0].Error() != `properties: line 2: "bad key": invalid key` || q.Contains("bad key") {
+		t.Error("errs[0] is ", errs[0])
+	}
+	if n, e := p.LoadWith(strings.NewReader(input), LoadOptions{}); n != 3 || e != nil {
+		t.Error("p.LoadWith(...) returned ", n, e)
+	}
+	q = p.Clone()
+	q.Clear()
+	q.LoadWith(strings.NewReader(input), LoadOptions{ValidateKeys: true, Document: true})
+	q.Set("port", "8080")
+	if s, _ := q.SaveString("", false); s != "port=8080\nbad\\ key=1\nhost=example.com\n" {
+		t.Errorf("q.SaveString(...) returned %q", s)
+	}
+}
+
+func TestKeysWithPrefix(t *testing.T) {
+	d := NewTable()
+	d.Set("plugin.a", "default")
+	d.Set("plugin.c", "3")
+	p := NewTableWith(d)
+	p.Set("plugin.a", "1")
+	p.Set("plugin.b", "2")
+	p.Set("pluginx", "4")
+	p.SetFallback("plugin.d", "fallback")
+	keys := p.KeysWithPrefix("plugin.")
+	if !slices.Equal(keys, []string{"plugin.a", "plugin.b", "plugin.c", "plugin.d"}) {
+		t.Error(`p.KeysWithPrefix("plugin.") returned `, keys)
+	}
+	if names := p.Sub("plugin.").PropertyNames(); !slices.Equal(names, []string{"a", "b", "c", "d"}) {
+		t.Error(`p.Sub("plugin.") holds `, names)
+	}
+	if keys := p.KeysWithPrefix(""); len(keys) != 5 {
+		t.Error(`p.KeysWithPrefix("") returned `, keys)
+	}
+	if keys := p.KeysWithPrefix("none."); keys == nil || len(keys) != 0 {
+		t.Error(`p.KeysWithPrefix("none.") returned `, keys)
+	}
+}
+
+func TestResolved(t *testing.T) {
+	d := NewTable()
+	d.Set("host", "localhost")
+	d.Set("port", "80")
+	p := NewTableWith(d)
+	p.Set("port", "8080")
+	p.SetFallback("user", "admin")
+	r := p.Resolved()
+	if r.Defaults() != nil || r.String() != "host=localhost\nport=8080\nuser=admin\n" {
+		t.Errorf("p.Resolved() returned %q", r.String())
+	}
+	r.Set("host", "changed")
+	if p.Get("host") != "localhost" || d.Get("host") != "localhost" {
+		t.Error("modifying the resolved table changed p")
+	}
+}
+
+func TestLoadSurrogatePair(t *testing.T) {
+	p := NewTable()
+	p.LoadString(`clef=\ud834\udd1e & \uD83D\uDE00`)
+	if s := p.Get("clef"); s != "\U0001D11E & \U0001F600" {
+		t.Errorf(`p.Get("clef") returned %q`, s)
+	}
+	p.LoadString(`lone=\ud834x\udd1e\ud834\ud834`)
+	if s := p.Get("lone"); s != "\ufffdx\ufffd\ufffd\ufffd" {
+		t.Errorf(`p.Get("lone") returned %q`, s)
+	}
+}
@@ -0,0 +1,98 @@
+package properties
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Rule checks the properties of a table. It returns nil if the table
+// satisfies the rule. Otherwise, it returns an error describing the
+// violation, or an ErrorList if there are several violations.
+// Rules are built by Required, When and RequiredIf, or by any function
+// having this signature, and are checked together by ValidateRules.
+type Rule func(p *Table) error
+
+// Required returns a rule requiring every key to be found in the primary or
+// in the secondary table. The rule reports, for each missing key, an error
+// wrapping ErrNotFound and naming the key.
+func Required(keys ...string) Rule {
+	return func(p *Table) error {
+		var errs ErrorList
+		for _, key := range keys {
+			if _, e := p.require(key); e != nil {
+				errs = append(errs, e)
+			}
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+		return nil
+	}
+}
+
+// Equals returns a condition, to be used with When, true if the value
+// associated with key is value. The key is searched in the primary and in
+// the secondary tables; a missing key doesn't satisfy the condition.
+func Equals(key, value string) func(p *Table) bool {
+	return func(p *Table) bool {
+		v, found := p.Lookup(key)
+		return found && v == value
+	}
+}
+
+// When returns a rule checking the given rules only if cond is true for the
+// table. It's satisfied if cond is false.
+func When(cond func(p *Table) bool, rules ...Rule) Rule {
+	return func(p *Table) error {
+		if !cond(p) {
+			return nil
+		}
+		return p.ValidateRules(rules)
+	}
+}
+
+// RequiredIf returns a rule requiring every key in keys to be found if the
+// value associated with key is value, as in "if tls.enabled is true, then
+// tls.cert and tls.key are required". The errors name the condition too.
+func RequiredIf(key, value string, keys ...string) Rule {
+	return func(p *Table) error {
+		if !Equals(key, value)(p) {
+			return nil
+		}
+		var errs ErrorList
+		for _, k := range keys {
+			if _, found := p.Lookup(k); !found {
+				e := fmt.Errorf("%w (required when %s=%s)", ErrNotFound, key, value)
+				errs = append(errs, keyError(k, e))
+			}
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+		return nil
+	}
+}
+
+// ValidateRules checks the table against all the rules, in order. It
+// returns nil if every rule is satisfied. Otherwise, it returns an ErrorList
+// holding all the violations, the ErrorList returned by a rule being
+// flattened into the result.
+func (p *Table) ValidateRules(rules []Rule) error {
+	var errs ErrorList
+	for _, rule := range rules {
+		e := rule(p)
+		if e == nil {
+			continue
+		}
+		var list ErrorList
+		if errors.As(e, &list) {
+			errs = append(errs, list...)
+		} else {
+			errs = append(errs, e)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package properties
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRules(t *testing.T) {
+	d := NewTable()
+	d.Set("tls.enabled", "false")
+	p := NewTableWith(d)
+	p.Set("host", "localhost")
+	rules := []Rule{
+		Required("host", "port"),
+		RequiredIf("tls.enabled", "true", "tls.cert", "tls.key"),
+		When(Equals("mode", "cluster"), Required("cluster.name")),
+	}
+	e := p.ValidateRules(rules)
+	var errs ErrorList
+	if !errors.As(e, &errs) || len(errs) != 1 || !errors.Is(errs[0], ErrNotFound) {
+		t.Fatal("ValidateRules() returned ", e)
+	}
+	if errs[0].Error() != `properties: "port": key not found` {
+		t.Error("errs[0] is ", errs[0])
+	}
+	p.Set("port", "443")
+	p.Set("tls.enabled", "true")
+	p.Set("tls.key", "server.key")
+	p.Set("mode", "cluster")
+	e = p.ValidateRules(rules)
+	if !errors.As(e, &errs) || len(errs) != 2 {
+		t.Fatal("ValidateRules() returned ", e)
+	}
+	if errs[0].Error() != `properties: "tls.cert": key not found (required when tls.enabled=true)` {
+		t.Error("errs[0] is ", errs[0])
+	}
+	if !errors.Is(errs[1], ErrNotFound) {
+		t.Error("errs[1] is ", errs[1])
+	}
+	p.Set("tls.cert", "server.crt")
+	p.Set("cluster.name", "main")
+	if e := p.ValidateRules(rules); e != nil {
+		t.Error("ValidateRules() returned ", e)
+	}
+}
@@ -0,0 +1,131 @@
+package properties
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// AtomicTable holds key-value pairs that any number of goroutines can read
+// without locking, while they are replaced as a whole by Store. The pairs
+// are never modified in place: Store builds a new map and swaps it in
+// atomically, so the readers see either the old or the new pairs, never a
+// mix. This fits configurations read on every request and reloaded rarely.
+// The zero value is an empty table ready to use.
+type AtomicTable struct {
+	data atomic.Pointer[map[string]string]
+}
+
+// Store replaces the key-value pairs of the table by a copy of data.
+func (p *AtomicTable) Store(data map[string]string) {
+	m := make(map[string]string, len(data))
+	for key, value := range data {
+		m[key] = value
+	}
+	p.data.Store(&m)
+}
+
+// StoreTable replaces the key-value pairs of the table by the pairs found by
+// Lookup in t: the pairs of its primary and secondary tables, and its
+// fallback values.
+func (p *AtomicTable) StoreTable(t *Table) {
+	m := t.flatten()
+	p.data.Store(&m)
+}
+
+// Lookup searches the value associated with key. It returns the value (or
+// the empty string) and a boolean indicating whether the value was found or
+// not.
+func (p *AtomicTable) Lookup(key string) (string, bool) {
+	data := p.data.Load()
+	if data == nil {
+		return "", false
+	}
+	value, found := (*data)[key]
+	return value, found
+}
+
+// Get returns the value associated with key, or the empty string if the key
+// isn't found.
+func (p *AtomicTable) Get(key string) string {
+	value, _ := p.Lookup(key)
+	return value
+}
+
+// SyncTable is a property table safe for concurrent use by multiple
+// goroutines. Its methods behave like the methods of Table having the same
+// names, each one running as a whole while holding a lock: the methods
+// reading the table (Get, Lookup) take a read lock and may run in parallel,
+// the methods modifying it (Set, Delete, Clear, Load) and Store, which
+// resets the modification mark, take the write lock. The secondary table
+// given to NewSyncTable isn't guarded by the lock: it's searched by the
+// readers without locking, so it must not be modified while the SyncTable
+// is in use. The zero value is an empty table, with no secondary table,
+// ready to use. A SyncTable must not be copied after first use.
+type SyncTable struct {
+	mu sync.RWMutex
+	t  Table
+}
+
+// NewSyncTable creates a new SyncTable using defaults for the secondary
+// table.
+func NewSyncTable(defaults *Table) *SyncTable {
+	return &SyncTable{t: Table{data: map[string]string{}, defaults: defaults}}
+}
+
+// Get returns the value associated with key, as done by Table.Get.
+func (p *SyncTable) Get(key string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.t.Get(key)
+}
+
+// Lookup searches the value associated with key, as done by Table.Lookup.
+func (p *SyncTable) Lookup(key string) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.t.Lookup(key)
+}
+
+// Set associates key with value in the primary table.
+func (p *SyncTable) Set(key, value string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.t.Set(key, value)
+}
+
+// Delete removes key from the primary table.
+func (p *SyncTable) Delete(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.t.Delete(key)
+}
+
+// Clear deletes all the key-value pairs in the primary table.
+func (p *SyncTable) Clear() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.t.Clear()
+}
+
+// Load reads key-value pairs from r into the primary table, as done by
+// Table.Load. The readers wait until the whole input is loaded, so they
+// never see a partially loaded input.
+// The function returns the number of key-value pairs loaded and any error
+// encountered.
+func (p *SyncTable) Load(r io.Reader) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.t.Load(r)
+}
+
+// Store writes the primary table to w, as done by Table.Store. The writers
+// wait until the whole table is written, so the output is a consistent
+// snapshot of the table.
+// The function returns the number of key-value pairs written and any error
+// encountered.
+func (p *SyncTable) Store(w io.Writer, ascii bool) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.t.Store(w, ascii)
+}
@@ -0,0 +1,118 @@
+package properties
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestAtomicTable(t *testing.T) {
+	var p AtomicTable
+	if _, found := p.Lookup("key"); found {
+		t.Error(`p.Lookup("key") found the key`)
+	}
+	data := map[string]string{"key": "value"}
+	p.Store(data)
+	data["key"] = "changed"
+	if p.Get("key") != "value" {
+		t.Error(`p.Get("key") != "value"`)
+	}
+	d := NewTable()
+	d.Set("host", "localhost")
+	q := NewTableWith(d)
+	q.Set("port", "80")
+	p.StoreTable(q)
+	if p.Get("host") != "localhost" || p.Get("port") != "80" || p.Get("key") != "" {
+		t.Error("StoreTable() stored ", p.Get("host"), p.Get("port"), p.Get("key"))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				p.Store(map[string]string{"port": strconv.Itoa(i)})
+				if p.Get("port") == "" {
+					t.Error(`p.Get("port") == ""`)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSyncTable(t *testing.T) {
+	d := NewTable()
+	d.Set("host", "localhost")
+	p := NewSyncTable(d)
+	if n, e := p.Load(strings.NewReader("port=80\n")); n != 1 || e != nil {
+		t.Error("Load() returned ", n, e)
+	}
+	if p.Get("host") != "localhost" || p.Get("port") != "80" {
+		t.Error("Get() returned ", p.Get("host"), p.Get("port"))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := "key." + strconv.Itoa(i)
+				p.Set(key, strconv.Itoa(j))
+				p.Delete(key)
+				p.Store(io.Discard, false)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, found := p.Lookup("port"); !found {
+					t.Error(`p.Lookup("port") didn't find the key`)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	p.Clear()
+	var b strings.Builder
+	if n, e := p.Store(&b, false); n != 0 || e != nil || b.Len() != 0 || p.Get("host") != "localhost" {
+		t.Error("Store() after Clear() returned ", n, e, b.String())
+	}
+	var z SyncTable
+	z.Set("key", "value")
+	if z.Get("key") != "value" {
+		t.Error("the zero SyncTable isn't usable")
+	}
+}
+
+func benchmarkData() map[string]string {
+	data := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		data["key."+strconv.Itoa(i)] = strconv.Itoa(i)
+	}
+	return data
+}
+
+func BenchmarkAtomicTableGet(b *testing.B) {
+	var p AtomicTable
+	p.Store(benchmarkData())
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			p.Get("key.42")
+		}
+	})
+}
+
+func BenchmarkSyncTableGet(b *testing.B) {
+	var p SyncTable
+	for key, value := range benchmarkData() {
+		p.Set(key, value)
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			p.Get("key.42")
+		}
+	})
+}
@@ -0,0 +1,384 @@
+package properties
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is reported by GetRequired and the typed getters, wrapped in a
+// *MissingKeyError, when the key is found neither in the primary nor in the
+// secondary table.
+var ErrNotFound = errors.New("key not found")
+
+// keyError annotates err with the key it's about.
+func keyError(key string, err error) error {
+	return fmt.Errorf("properties: %q: %w", key, err)
+}
+
+// MissingKeyError records a key found neither in the primary nor in the
+// secondary table.
+type MissingKeyError struct {
+	Key string
+}
+
+// Error returns the missing key and the reason of the failure.
+func (e *MissingKeyError) Error() string {
+	return fmt.Sprintf("properties: %q: %v", e.Key, ErrNotFound)
+}
+
+// Unwrap returns ErrNotFound.
+func (e *MissingKeyError) Unwrap() error {
+	return ErrNotFound
+}
+
+// require returns the value associated with key, or a *MissingKeyError if
+// the key isn't found.
+func (p *Table) require(key string) (string, error) {
+	value, found := p.Lookup(key)
+	if !found {
+		return "", &MissingKeyError{key}
+	}
+	return value, nil
+}
+
+// GetRequired returns the value associated with key, searched as done by
+// Get. Unlike Get, it returns a *MissingKeyError, which wraps ErrNotFound, if
+// the key isn't found, so that a missing mandatory property can be reported
+// instead of being read as "". A key present with an empty value isn't an
+// error.
+func (p *Table) GetRequired(key string) (string, error) {
+	return p.require(key)
+}
+
+// GetInt returns the value associated with key, parsed as a decimal int by
+// strconv.Atoi. The key is searched in the primary and in the secondary
+// tables. If the key isn't found, the error wraps ErrNotFound. If the value
+// can't be parsed, the error wraps the *strconv.NumError. In both cases, the
+// error names the key.
+func (p *Table) GetInt(key string) (int, error) {
+	value, e := p.require(key)
+	if e != nil {
+		return 0, e
+	}
+	i, e := strconv.Atoi(value)
+	if e != nil {
+		return 0, keyError(key, e)
+	}
+	return i, nil
+}
+
+// GetIntOr returns the value associated with key, parsed as by GetInt, or
+// fallback if the key isn't found or its value can't be parsed.
+func (p *Table) GetIntOr(key string, fallback int) int {
+	if i, e := p.GetInt(key); e == nil {
+		return i
+	}
+	return fallback
+}
+
+// GetFloat64 returns the value associated with key, parsed as a float64 by
+// strconv.ParseFloat. The errors are reported as for GetInt.
+func (p *Table) GetFloat64(key string) (float64, error) {
+	value, e := p.require(key)
+	if e != nil {
+		return 0, e
+	}
+	f, e := strconv.ParseFloat(value, 64)
+	if e != nil {
+		return 0, keyError(key, e)
+	}
+	return f, nil
+}
+
+// GetFloat64Or returns the value associated with key, parsed as by
+// GetFloat64, or fallback if the key isn't found or its value can't be
+// parsed.
+func (p *Table) GetFloat64Or(key string, fallback float64) float64 {
+	if f, e := p.GetFloat64(key); e == nil {
+		return f
+	}
+	return fallback
+}
+
+// defaultTrueValues and defaultFalseValues hold the values read as true and
+// false by GetBool, unless the table sets its own by SetBoolValues.
+var (
+	defaultTrueValues  = []string{"1", "t", "true", "y", "yes", "on"}
+	defaultFalseValues = []string{"0", "f", "false", "n", "no", "off"}
+)
+
+// TrueValues returns a copy of the values read as true by GetBool, compared
+// without regard to case, for the tables not setting their own by
+// SetBoolValues.
+func TrueValues() []string {
+	return slices.Clone(defaultTrueValues)
+}
+
+// FalseValues returns a copy of the values read as false by GetBool,
+// compared without regard to case, for the tables not setting their own by
+// SetBoolValues.
+func FalseValues() []string {
+	return slices.Clone(defaultFalseValues)
+}
+
+// SetBoolValues sets the values read as true and as false by GetBool,
+// Binder.Bool and Unmarshal on the table, compared without regard to case.
+// The slices are copied. A nil slice selects the values returned by
+// TrueValues or FalseValues. The values are copied by Clone; the secondary
+// table keeps its own.
+func (p *Table) SetBoolValues(trueValues, falseValues []string) {
+	p.trueValues = slices.Clone(trueValues)
+	p.falseValues = slices.Clone(falseValues)
+}
+
+// parseBool returns the boolean represented by s, one of the values read as
+// true or false by the table, or an error like those of strconv.ParseBool.
+func (p *Table) parseBool(s string) (bool, error) {
+	accepted := p.trueValues
+	if accepted == nil {
+		accepted = defaultTrueValues
+	}
+	for _, t := range accepted {
+		if strings.EqualFold(s, t) {
+			return true, nil
+		}
+	}
+	accepted = p.falseValues
+	if accepted == nil {
+		accepted = defaultFalseValues
+	}
+	for _, f := range accepted {
+		if strings.EqualFold(s, f) {
+			return false, nil
+		}
+	}
+	return false, &strconv.NumError{Func: "ParseBool", Num: s, Err: strconv.ErrSyntax}
+}
+
+// GetBool returns the value associated with key, parsed as a boolean. The
+// values set by SetBoolValues are accepted, without regard to case: by
+// default, those returned by TrueValues and FalseValues, which are the
+// values accepted by strconv.ParseBool, "y", "yes", "on", "n", "no" and
+// "off". The errors are reported as for GetInt, the error for a value that
+// can't be parsed wrapping a *strconv.NumError holding the value.
+func (p *Table) GetBool(key string) (bool, error) {
+	value, e := p.require(key)
+	if e != nil {
+		return false, e
+	}
+	b, e := p.parseBool(value)
+	if e != nil {
+		return false, keyError(key, e)
+	}
+	return b, nil
+}
+
+// GetBoolOr returns the value associated with key, parsed as by GetBool, or
+// fallback if the key isn't found or its value can't be parsed.
+func (p *Table) GetBoolOr(key string, fallback bool) bool {
+	if b, e := p.GetBool(key); e == nil {
+		return b
+	}
+	return fallback
+}
+
+// GetDuration returns the value associated with key, parsed as a duration
+// by time.ParseDuration, like "30s" or "1h30m". The errors are reported as
+// for GetInt, the error for a value that can't be parsed wrapping the error
+// of time.ParseDuration, which holds the value.
+func (p *Table) GetDuration(key string) (time.Duration, error) {
+	value, e := p.require(key)
+	if e != nil {
+		return 0, e
+	}
+	d, e := time.ParseDuration(value)
+	if e != nil {
+		return 0, keyError(key, e)
+	}
+	return d, nil
+}
+
+// GetDurationOr returns the value associated with key, parsed as by
+// GetDuration, or fallback if the key isn't found or its value can't be
+// parsed.
+func (p *Table) GetDurationOr(key string, fallback time.Duration) time.Duration {
+	if d, e := p.GetDuration(key); e == nil {
+		return d
+	}
+	return fallback
+}
+
+func (p *Table) getBytes(key string, enc *base64.Encoding) ([]byte, error) {
+	value, e := p.require(key)
+	if e != nil {
+		return nil, e
+	}
+	b, e := enc.DecodeString(value)
+	if e != nil {
+		return nil, keyError(key, e)
+	}
+	return b, nil
+}
+
+// GetBytesBase64 returns the bytes encoded, using the standard base64
+// encoding, by the value associated with key. The key is searched in the
+// primary and in the secondary tables. If the key isn't found, the error
+// wraps ErrNotFound. If the value can't be decoded, the error wraps the
+// decoding error. In both cases, the error names the key.
+func (p *Table) GetBytesBase64(key string) ([]byte, error) {
+	return p.getBytes(key, base64.StdEncoding)
+}
+
+// GetBytesBase64URL is like GetBytesBase64, but it uses the URL-safe base64
+// encoding.
+func (p *Table) GetBytesBase64URL(key string) ([]byte, error) {
+	return p.getBytes(key, base64.URLEncoding)
+}
+
+// GetStringSlice returns the elements of the list held by the value
+// associated with key, split around each instance of sep as done by
+// strings.Split. The surrounding white space of each element is trimmed, and
+// the elements left empty are dropped, so that "a, b,, c," is read as "a",
+// "b" and "c". It returns an empty slice if key isn't found.
+func (p *Table) GetStringSlice(key, sep string) []string {
+	value, found := p.Lookup(key)
+	if !found {
+		return []string{}
+	}
+	elems := strings.Split(value, sep)
+	values := make([]string, 0, len(elems))
+	for _, elem := range elems {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			values = append(values, elem)
+		}
+	}
+	return values
+}
+
+// SetInt associates key with the decimal form of v, as formatted by
+// strconv.Itoa, in the property table.
+func (p *Table) SetInt(key string, v int) {
+	p.Set(key, strconv.Itoa(v))
+}
+
+// SetBool associates key with "true" or "false", as formatted by
+// strconv.FormatBool, in the property table.
+func (p *Table) SetBool(key string, v bool) {
+	p.Set(key, strconv.FormatBool(v))
+}
+
+// SetFloat64 associates key with the shortest form of v read back exactly
+// by GetFloat64, as formatted by strconv.FormatFloat with the 'g' format
+// and the precision -1, in the property table.
+func (p *Table) SetFloat64(key string, v float64) {
+	p.Set(key, strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+// SetDuration associates key with the form of d read back by GetDuration,
+// as formatted by d.String, like "1h30m0s", in the property table.
+func (p *Table) SetDuration(key string, d time.Duration) {
+	p.Set(key, d.String())
+}
+
+// SetBytesBase64 associates key with the standard base64 encoding of b in
+// the property table.
+func (p *Table) SetBytesBase64(key string, b []byte) {
+	p.Set(key, base64.StdEncoding.EncodeToString(b))
+}
+
+// SetBytesBase64URL associates key with the URL-safe base64 encoding of b in
+// the property table.
+func (p *Table) SetBytesBase64URL(key string, b []byte) {
+	p.Set(key, base64.URLEncoding.EncodeToString(b))
+}
+
+// SetStringSlice associates key with the elements of values joined by sep.
+// The elements aren't escaped: GetStringSlice, with the same separator,
+// reads back the original elements only if none of them contains sep, has
+// surrounding white space or is empty. Such elements aren't supported.
+func (p *Table) SetStringSlice(key string, values []string, sep string) {
+	p.Set(key, strings.Join(values, sep))
+}
+
+// Binder reads typed values from a table, recording the errors instead of
+// returning them, so that all the problems found while reading many values
+// are reported at once by Err. For example:
+// ```
+// b := p.Binder()
+// host := b.String("server.host")
+// port := b.Int("server.port")
+// if e := b.Err(); e != nil { return e }
+// ```
+type Binder struct {
+	p    *Table
+	errs ErrorList
+}
+
+// Binder returns a new Binder reading the values of p.
+func (p *Table) Binder() *Binder {
+	return &Binder{p: p}
+}
+
+func (b *Binder) record(e error) {
+	if e != nil {
+		b.errs = append(b.errs, e)
+	}
+}
+
+// String returns the value associated with key. If the key isn't found, it
+// records an error wrapping ErrNotFound and returns the empty string.
+func (b *Binder) String(key string) string {
+	value, e := b.p.require(key)
+	b.record(e)
+	return value
+}
+
+// Int returns the value associated with key, parsed as by GetInt. If the
+// key isn't found or its value can't be parsed, it records the error and
+// returns 0.
+func (b *Binder) Int(key string) int {
+	i, e := b.p.GetInt(key)
+	b.record(e)
+	return i
+}
+
+// Float64 returns the value associated with key, parsed as by GetFloat64.
+// If the key isn't found or its value can't be parsed, it records the error
+// and returns 0.
+func (b *Binder) Float64(key string) float64 {
+	f, e := b.p.GetFloat64(key)
+	b.record(e)
+	return f
+}
+
+// Bool returns the value associated with key, parsed as by GetBool. If the
+// key isn't found or its value can't be parsed, it records the error and
+// returns false.
+func (b *Binder) Bool(key string) bool {
+	v, e := b.p.GetBool(key)
+	b.record(e)
+	return v
+}
+
+// Duration returns the value associated with key, parsed as by GetDuration.
+// If the key isn't found or its value can't be parsed, it records the error
+// and returns 0.
+func (b *Binder) Duration(key string) time.Duration {
+	d, e := b.p.GetDuration(key)
+	b.record(e)
+	return d
+}
+
+// Err returns nil if no error was recorded, otherwise an ErrorList holding
+// the recorded errors, in the order they occurred.
+func (b *Binder) Err() error {
+	if len(b.errs) > 0 {
+		return b.errs
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package properties
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBytesBase64(t *testing.T) {
+	data := []byte{0xfb, 0xff, 0x00, 'g', 'o'}
+	p := NewTable()
+	p.SetBytesBase64("std", data)
+	p.SetBytesBase64URL("url", data)
+	if p.Get("std") != "+/8AZ28=" || p.Get("url") != "-_8AZ28=" {
+		t.Error("SetBytesBase64() set ", p.Get("std"), p.Get("url"))
+	}
+	if b, e := p.GetBytesBase64("std"); e != nil || !bytes.Equal(b, data) {
+		t.Error(`p.GetBytesBase64("std") returned `, b, e)
+	}
+	if b, e := p.GetBytesBase64URL("url"); e != nil || !bytes.Equal(b, data) {
+		t.Error(`p.GetBytesBase64URL("url") returned `, b, e)
+	}
+	if _, e := p.GetBytesBase64("url"); e == nil {
+		t.Error(`p.GetBytesBase64("url") returned no error`)
+	}
+	if _, e := p.GetBytesBase64("missing"); !errors.Is(e, ErrNotFound) {
+		t.Error(`p.GetBytesBase64("missing") returned `, e)
+	}
+}
+
+func TestGetIntFloat64(t *testing.T) {
+	p := NewTable()
+	p.LoadString("port=8080\nratio=0.75\nbad=eighty\n")
+	if i, e := p.GetInt("port"); i != 8080 || e != nil {
+		t.Error(`p.GetInt("port") returned `, i, e)
+	}
+	if _, e := p.GetInt("bad"); e == nil || !strings.Contains(e.Error(), "eighty") {
+		t.Error(`p.GetInt("bad") returned `, e)
+	}
+	if f, e := p.GetFloat64("ratio"); f != 0.75 || e != nil {
+		t.Error(`p.GetFloat64("ratio") returned `, f, e)
+	}
+	if p.GetIntOr("bad", 80) != 80 || p.GetIntOr("missing", 80) != 80 {
+		t.Error(`p.GetIntOr() didn't return the fallback`)
+	}
+	if p.GetFloat64Or("ratio", 1) != 0.75 || p.GetFloat64Or("missing", 1) != 1 {
+		t.Error(`p.GetFloat64Or() returned a wrong value`)
+	}
+}
+
+func TestBinder(t *testing.T) {
+	p := NewTable()
+	p.LoadString("server.host=localhost\nserver.port=8080\nserver.ratio=half\n")
+	b := p.Binder()
+	host := b.String("server.host")
+	port := b.Int("server.port")
+	if host != "localhost" || port != 8080 || b.Err() != nil {
+		t.Error("Binder returned ", host, port, b.Err())
+	}
+	b.String("server.name")
+	b.Float64("server.ratio")
+	b.Int("server.workers")
+	var errs ErrorList
+	if !errors.As(b.Err(), &errs) || len(errs) != 3 {
+		t.Fatal("Binder.Err() returned ", b.Err())
+	}
+	if !errors.Is(errs[0], ErrNotFound) || errors.Is(errs[1], ErrNotFound) || !errors.Is(errs[2], ErrNotFound) {
+		t.Error("Binder.Err() returned ", b.Err())
+	}
+}
+
+func TestGetBool(t *testing.T) {
+	p := NewTable()
+	p.LoadString("a=true\nb=Yes\nc=OFF\nd=0\nbad=maybe\n")
+	for key, want := range map[string]bool{"a": true, "b": true, "c": false, "d": false} {
+		if v, e := p.GetBool(key); v != want || e != nil {
+			t.Error(`p.GetBool("`+key+`") returned `, v, e)
+		}
+	}
+	if _, e := p.GetBool("bad"); e == nil || !strings.Contains(e.Error(), "maybe") {
+		t.Error(`p.GetBool("bad") returned `, e)
+	}
+	if _, e := p.GetBool("missing"); !errors.Is(e, ErrNotFound) {
+		t.Error(`p.GetBool("missing") returned `, e)
+	}
+	if !p.GetBoolOr("bad", true) || !p.GetBoolOr("missing", true) || p.GetBoolOr("c", true) {
+		t.Error(`p.GetBoolOr() returned a wrong value`)
+	}
+	b := p.Binder()
+	if !b.Bool("a") || b.Bool("bad") || b.Err() == nil {
+		t.Error(`b.Bool() failed`)
+	}
+	TrueValues()[0] = "maybe"
+	if _, e := p.GetBool("bad"); e == nil || TrueValues()[0] != "1" {
+		t.Error("TrueValues() returned ", TrueValues())
+	}
+	q := p.Clone()
+	q.SetBoolValues([]string{"si", "maybe"}, []string{"no"})
+	if v, e := q.GetBool("bad"); !v || e != nil {
+		t.Error(`q.GetBool("bad") returned `, v, e)
+	}
+	if v, e := q.GetBool("a"); e == nil {
+		t.Error(`q.GetBool("a") returned `, v, e)
+	}
+	if _, e := p.GetBool("bad"); e == nil {
+		t.Error(`SetBoolValues() changed the values of another table`)
+	}
+	var config struct {
+		Bad bool `prop:"bad"`
+	}
+	if e := Unmarshal(q, &config); e != nil || !config.Bad {
+		t.Error("Unmarshal() returned ", e, config)
+	}
+	q.SetBoolValues(nil, nil)
+	if v, e := q.GetBool("a"); !v || e != nil {
+		t.Error(`q.GetBool("a") returned `, v, e)
+	}
+}
+
+func TestGetDuration(t *testing.T) {
+	p := NewTable()
+	p.LoadString("timeout=30s\ninterval=1h30m\nbad=soon\n")
+	if d, e := p.GetDuration("timeout"); d != 30*time.Second || e != nil {
+		t.Error(`p.GetDuration("timeout") returned `, d, e)
+	}
+	if d, e := p.GetDuration("interval"); d != 90*time.Minute || e != nil {
+		t.Error(`p.GetDuration("interval") returned `, d, e)
+	}
+	if _, e := p.GetDuration("bad"); e == nil || !strings.Contains(e.Error(), "soon") {
+		t.Error(`p.GetDuration("bad") returned `, e)
+	}
+	if _, e := p.GetDuration("missing"); !errors.Is(e, ErrNotFound) {
+		t.Error(`p.GetDuration("missing") returned `, e)
+	}
+	if p.GetDurationOr("bad", time.Second) != time.Second || p.GetDurationOr("timeout", 0) != 30*time.Second {
+		t.Error(`p.GetDurationOr() returned a wrong value`)
+	}
+	b := p.Binder()
+	if b.Duration("timeout") != 30*time.Second || b.Duration("missing") != 0 || b.Err() == nil {
+		t.Error(`b.Duration() failed`)
+	}
+}
+
+func TestTypedSetters(t *testing.T) {
+	p := NewTable()
+	p.SetInt("int", -42)
+	p.SetBool("bool", true)
+	p.SetFloat64("float", 0.1+0.2)
+	p.SetDuration("duration", 90*time.Minute)
+	if p.Get("int") != "-42" || p.Get("bool") != "true" || p.Get("duration") != "1h30m0s" {
+		t.Error("the typed setters returned ", p.Get("int"), p.Get("bool"), p.Get("duration"))
+	}
+	if i, e := p.GetInt("int"); i != -42 || e != nil {
+		t.Error(`p.GetInt("int") returned `, i, e)
+	}
+	if b, e := p.GetBool("bool"); !b || e != nil {
+		t.Error(`p.GetBool("bool") returned `, b, e)
+	}
+	if f, e := p.GetFloat64("float"); f != 0.1+0.2 || e != nil {
+		t.Error(`p.GetFloat64("float") returned `, f, e)
+	}
+	if d, e := p.GetDuration("duration"); d != 90*time.Minute || e != nil {
+		t.Error(`p.GetDuration("duration") returned `, d, e)
+	}
+}
+
+func TestGetStringSlice(t *testing.T) {
+	d := NewTable()
+	d.Set("hosts", "a.com, b.com ,, c.com,")
+	p := NewTableWith(d)
+	p.Set("empty", " , ")
+	p.Set("path", "/bin:/usr/bin")
+	if s := p.GetStringSlice("hosts", ","); !slices.Equal(s, []string{"a.com", "b.com", "c.com"}) {
+		t.Errorf(`p.GetStringSlice("hosts", ",") returned %q`, s)
+	}
+	if s := p.GetStringSlice("path", ":"); !slices.Equal(s, []string{"/bin", "/usr/bin"}) {
+		t.Errorf(`p.GetStringSlice("path", ":") returned %q`, s)
+	}
+	if s := p.GetStringSlice("empty", ","); s == nil || len(s) != 0 {
+		t.Errorf(`p.GetStringSlice("empty", ",") returned %q`, s)
+	}
+	if s := p.GetStringSlice("missing", ","); s == nil || len(s) != 0 {
+		t.Errorf(`p.GetStringSlice("missing", ",") returned %q`, s)
+	}
+}
+
+func TestSetStringSlice(t *testing.T) {
+	p := NewTable()
+	hosts := []string{"a.com", "b.com", "c.com"}
+	p.SetStringSlice("hosts", hosts, ", ")
+	if s := p.Get("hosts"); s != "a.com, b.com, c.com" {
+		t.Error(`p.Get("hosts") returned `, s)
+	}
+	if s := p.GetStringSlice("hosts", ","); !slices.Equal(s, hosts) {
+		t.Errorf(`p.GetStringSlice("hosts", ",") returned %q`, s)
+	}
+	p.SetStringSlice("none", nil, ",")
+	if s, found := p.Lookup("none"); !found || s != "" {
+		t.Error(`p.Lookup("none") returned `, s, found)
+	}
+}
+
+func TestGetRequired(t *testing.T) {
+	d := NewTable()
+	d.Set("db.host", "localhost")
+	p := NewTableWith(d)
+	p.Set("db.password", "")
+	if s, e := p.GetRequired("db.host"); s != "localhost" || e != nil {
+		t.Error(`p.GetRequired("db.host") returned `, s, e)
+	}
+	if s, e := p.GetRequired("db.password"); s != "" || e != nil {
+		t.Error(`p.GetRequired("db.password") returned `, s, e)
+	}
+	s, e := p.GetRequired("db.port")
+	var missing *MissingKeyError
+	if s != "" || !errors.As(e, &missing) || missing.Key != "db.port" || !errors.Is(e, ErrNotFound) {
+		t.Error(`p.GetRequired("db.port") returned `, s, e)
+	}
+	if e.Error() != `properties: "db.port": key not found` {
+		t.Error(`p.GetRequired("db.port") returned `, e)
+	}
+	if _, e := p.GetInt("db.port"); !errors.As(e, &missing) {
+		t.Error(`p.GetInt("db.port") returned `, e)
+	}
+}
@@ -0,0 +1,83 @@
+package properties
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// xmlHeader is written by StoreXML before the entries, as done by the
+// storeToXML method of the Java Properties class.
+const xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<!DOCTYPE properties SYSTEM "http://java.sun.com/dtd/properties.dtd">
+<properties>
+`
+
+// xmlProperties is the root element of the XML form of a table.
+type xmlProperties struct {
+	XMLName xml.Name   `xml:"properties"`
+	Comment string     `xml:"comment"`
+	Entries []xmlEntry `xml:"entry"`
+}
+
+// xmlEntry is a key-value pair in the XML form of a table.
+type xmlEntry struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// LoadXML reads key-value pairs from r in the XML form used by the
+// loadFromXML method of the Java Properties class: a <properties> root
+// element holding an optional <comment> element, ignored, followed by
+// <entry key="..."> elements holding the values as text. The XML
+// declaration and the DOCTYPE are optional, and the DTD isn't fetched. If a
+// key appears several times, its last value is kept. If the input isn't
+// valid, the table is left unchanged.
+// The function returns the number of key-value pairs loaded and any error
+// encountered.
+func (p *Table) LoadXML(r io.Reader) (int, error) {
+	var doc xmlProperties
+	if e := xml.NewDecoder(r).Decode(&doc); e != nil {
+		return 0, e
+	}
+	for _, entry := range doc.Entries {
+		p.Set(entry.Key, entry.Value)
+	}
+	return len(doc.Entries), nil
+}
+
+// StoreXML writes the key-value pairs of the primary table to w in the XML
+// form read by LoadXML and by the loadFromXML method of the Java Properties
+// class, encoded as UTF-8, in the order used by Store. If comment isn't
+// empty, it's written as the <comment> element. The keys, the values and
+// the comment are escaped as XML text; the runes that XML can't represent,
+// like most of the control characters, are replaced by U+FFFD.
+// The function returns the number of key-value pairs written and any error
+// encountered.
+func (p *Table) StoreXML(w io.Writer, comment string) (int, error) {
+	var b bytes.Buffer
+	b.WriteString(xmlHeader)
+	if comment != "" {
+		b.WriteString("<comment>")
+		xml.EscapeText(&b, []byte(comment))
+		b.WriteString("</comment>\n")
+	}
+	if _, e := w.Write(b.Bytes()); e != nil {
+		return 0, e
+	}
+	count := 0
+	for _, key := range p.keys() {
+		b.Reset()
+		b.WriteString(`<entry key="`)
+		xml.EscapeText(&b, []byte(key))
+		b.WriteString(`">`)
+		xml.EscapeText(&b, []byte(p.data[key]))
+		b.WriteString("</entry>\n")
+		if _, e := w.Write(b.Bytes()); e != nil {
+			return count, e
+		}
+		count += 1
+	}
+	_, e := io.WriteString(w, "</properties>\n")
+	return count, e
+}
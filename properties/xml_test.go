@@ -0,0 +1,51 @@
+package properties
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestXML(t *testing.T) {
+	p := NewTable()
+	p.Set("name", `<"Tom & Jerry">`)
+	p.Set("multi", "a\r\n\tb ")
+	p.Set("key with 'quotes'", "")
+	var b strings.Builder
+	n, e := p.StoreXML(&b, "Cartoons & co.")
+	want := `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<!DOCTYPE properties SYSTEM "http://java.sun.com/dtd/properties.dtd">
+<properties>
+<comment>Cartoons &amp; co.</comment>
+<entry key="key with &#39;quotes&#39;"></entry>
+<entry key="multi">a&#xD;&#xA;&#x9;b </entry>
+<entry key="name">&lt;&#34;Tom &amp; Jerry&#34;&gt;</entry>
+</properties>
+`
+	if n != 3 || e != nil || b.String() != want {
+		t.Errorf("p.StoreXML(...) returned %d, %v, wrote %q", n, e, b.String())
+	}
+	q := NewTable()
+	if n, e := q.LoadXML(strings.NewReader(b.String())); n != 3 || e != nil {
+		t.Error("q.LoadXML(...) returned ", n, e)
+	}
+	if !q.Equal(p) {
+		t.Errorf("q.LoadXML(...) loaded %q", q.String())
+	}
+	java := `<?xml version="1.0" encoding="UTF-8" standalone="no"?>
+<!DOCTYPE properties SYSTEM "http://java.sun.com/dtd/properties.dtd">
+<properties>
+  <entry key="host">localhost</entry>
+  <entry key="port">80</entry>
+  <entry key="port">8080</entry>
+</properties>`
+	q = NewTable()
+	if n, e := q.LoadXML(strings.NewReader(java)); n != 3 || e != nil || q.Len() != 2 || q.Get("port") != "8080" {
+		t.Error("q.LoadXML(...) returned ", n, e, q.String())
+	}
+	if n, e := q.LoadXML(strings.NewReader(`<properties><entry key="a">1</entry>`)); n != 0 || e == nil || q.Len() != 2 {
+		t.Error("q.LoadXML(...) of a truncated input returned ", n, e)
+	}
+	if _, e := q.LoadXML(strings.NewReader(`<config><entry key="a">1</entry></config>`)); e == nil {
+		t.Error("q.LoadXML(...) of another root element returned no error")
+	}
+}